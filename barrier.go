@@ -0,0 +1,160 @@
+package doozer
+
+import (
+	"io"
+	"sync"
+)
+
+// A Barrier lets n participants wait for one another. Each enters
+// by creating a file, named by its id, in the barrier's directory,
+// and leaves by deleting it.
+//
+// A participant that dies after Enter stays in the barrier until
+// someone deletes its file; use Members to see who is waiting, and
+// Cancel to give up on a wait.
+type Barrier struct {
+	c    Doozer
+	path string
+	n    int
+
+	mu       sync.Mutex
+	w        *Watch // the wait in progress, if any
+	canceled bool
+}
+
+// NewBarrier returns a Barrier for n participants, using the
+// directory path in the store behind c.
+func NewBarrier(c Doozer, path string, n int) *Barrier {
+	return &Barrier{c: c, path: path, n: n}
+}
+
+// Enter adds id to b, then waits until b has at least n members.
+// It counts them as of its own arrival, so it can't miss the
+// barrier filling even if everyone else has left by then.
+func (b *Barrier) Enter(id string) error {
+	rev, err := b.c.Set(b.path+"/"+id, clobber, nil)
+	if err != nil {
+		return err
+	}
+	return b.await(rev, func(k int) bool { return k >= b.n })
+}
+
+// Leave removes id from b, without waiting for anyone.
+func (b *Barrier) Leave(id string) error {
+	_, err := b.leave(id)
+	return err
+}
+
+// A revDeleter can report the revision of a deletion.
+type revDeleter interface {
+	DelRev(file string, rev int64) (int64, error)
+}
+
+// leave removes id from b and returns a revision at which it is
+// gone. If b's Doozer can't say when the deletion happened, that is
+// the current revision: members only leave once b has filled, so
+// counting later can't make LeaveAndWait miss b emptying.
+func (b *Barrier) leave(id string) (int64, error) {
+	var rev int64
+	var err error
+	if d, ok := b.c.(revDeleter); ok {
+		rev, err = d.DelRev(b.path+"/"+id, clobber)
+	} else {
+		err = b.c.Del(b.path+"/"+id, clobber)
+	}
+	if err != nil && !isErr(err, ErrNoEnt) {
+		return 0, err
+	}
+	if rev == 0 {
+		return b.c.Rev()
+	}
+	return rev, nil
+}
+
+// LeaveAndWait removes id from b, then waits until every other
+// member has left too. Together with Enter, this makes a double
+// barrier: no participant finishes until all have.
+func (b *Barrier) LeaveAndWait(id string) error {
+	rev, err := b.leave(id)
+	if err != nil {
+		return err
+	}
+	return b.await(rev, func(k int) bool { return k == 0 })
+}
+
+// Members returns the ids now in b.
+func (b *Barrier) Members() ([]string, error) {
+	rev, err := b.c.Rev()
+	if err != nil {
+		return nil, err
+	}
+	return getdirOpt(b.c, b.path, rev)
+}
+
+// Cancel stops a wait in Enter or LeaveAndWait, which returns
+// io.EOF, as do any later waits. It does not remove anyone from b.
+func (b *Barrier) Cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.canceled = true
+	if b.w != nil {
+		b.w.Cancel()
+	}
+}
+
+// await waits until done reports true for the number of members,
+// counting them at rev and then following every change after it.
+// If the server has forgotten the revisions being watched, it
+// counts the members again at the last revision it saw, and carries
+// on from there.
+func (b *Barrier) await(rev int64, done func(int) bool) error {
+	for {
+		names, err := getdirOpt(b.c, b.path, rev)
+		if err != nil {
+			return err
+		}
+		members := make(map[string]bool)
+		for _, name := range names {
+			members[name] = true
+		}
+		if done(len(members)) {
+			return nil
+		}
+		rev, err = b.follow(rev, members, done)
+		if !isErr(err, ErrTooLate) {
+			return err
+		}
+	}
+}
+
+// follow applies the changes to b after rev to members until done
+// reports true for their number. It returns the revision of the last
+// change it applied.
+func (b *Barrier) follow(rev int64, members map[string]bool, done func(int) bool) (int64, error) {
+	b.mu.Lock()
+	if b.canceled {
+		b.mu.Unlock()
+		return rev, io.EOF
+	}
+	w := NewWatch(b.c, b.path+"/*", rev+1)
+	b.w = w
+	b.mu.Unlock()
+	defer w.Cancel()
+
+	for {
+		ev, err := w.Next()
+		if err != nil {
+			return rev, err
+		}
+		rev = ev.Rev
+		switch {
+		case ev.IsSet():
+			members[basename(ev.Path)] = true
+		case ev.IsDel():
+			delete(members, basename(ev.Path))
+		}
+		if done(len(members)) {
+			return rev, nil
+		}
+	}
+}
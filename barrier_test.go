@@ -0,0 +1,121 @@
+package doozer
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// plainDoozer hides everything of a Conn but the Doozer methods.
+type plainDoozer struct {
+	Doozer
+}
+
+func TestBarrier(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+
+	for _, d := range []Doozer{c, plainDoozer{c}} {
+		path := fmt.Sprintf("/barrier/%T", d)
+		path = strings.NewReplacer("*", "", ".", "_").Replace(path)
+		barrierRound(t, d, path, 8)
+	}
+}
+
+// TestBarrierRounds runs many rounds, so that late entrants often
+// arrive after the early ones have seen the barrier fill and left.
+func TestBarrierRounds(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+
+	for i := 0; i < 20; i++ {
+		barrierRound(t, c, fmt.Sprint("/rounds/conn", i), 8)
+		barrierRound(t, plainDoozer{c}, fmt.Sprint("/rounds/plain", i), 8)
+	}
+}
+
+// barrierRound has n goroutines, arriving at random times, pass
+// through a double barrier at path, and checks that none gets
+// through Enter or LeaveAndWait early.
+func barrierRound(t *testing.T, d Doozer, path string, n int32) {
+	var entered, left int32
+	errc := make(chan error, n)
+	var wg sync.WaitGroup
+	for i := int32(0); i < n; i++ {
+		wg.Add(1)
+		go func(id string, delay time.Duration) {
+			defer wg.Done()
+			b := NewBarrier(d, path, int(n))
+			time.Sleep(delay)
+
+			atomic.AddInt32(&entered, 1)
+			if err := b.Enter(id); err != nil {
+				errc <- err
+				return
+			}
+			if k := atomic.LoadInt32(&entered); k != n {
+				errc <- fmt.Errorf("%s passed Enter with %d of %d in", id, k, n)
+				return
+			}
+
+			time.Sleep(delay)
+			atomic.AddInt32(&left, 1)
+			if err := b.LeaveAndWait(id); err != nil {
+				errc <- err
+				return
+			}
+			if k := atomic.LoadInt32(&left); k != n {
+				errc <- fmt.Errorf("%s passed LeaveAndWait with %d of %d out", id, k, n)
+			}
+		}(fmt.Sprint("w", i), time.Duration(rand.Intn(20))*time.Millisecond)
+	}
+	wg.Wait()
+	close(errc)
+	for err := range errc {
+		t.Errorf("%T %s: %v", d, path, err)
+	}
+}
+
+func TestBarrierMembers(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+
+	d := plainDoozer{c}
+	b := NewBarrier(d, "/members", 3)
+	ids, err := b.Members()
+	if err != nil || len(ids) != 0 {
+		t.Fatalf("Members of an empty barrier: %v %v", ids, err)
+	}
+
+	errc := make(chan error)
+	var bs []*Barrier
+	for _, id := range []string{"b", "a"} {
+		pb := NewBarrier(d, "/members", 3)
+		bs = append(bs, pb)
+		go func(id string) { errc <- pb.Enter(id) }(id)
+	}
+	settle(func() bool {
+		ids, _ := b.Members()
+		return len(ids) == 2
+	})
+	ids, _ = b.Members()
+	sort.Strings(ids)
+	if strings.Join(ids, ",") != "a,b" {
+		t.Fatalf("Members: %v", ids)
+	}
+
+	// The third never comes; give up.
+	for _, pb := range bs {
+		pb.Cancel()
+	}
+	for range bs {
+		if err := <-errc; err == nil {
+			t.Fatal("Enter after Cancel succeeded")
+		}
+	}
+}
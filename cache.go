@@ -0,0 +1,214 @@
+package doozer
+
+import (
+	"container/list"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// A Cache serves reads of files matching a glob from memory,
+// kept fresh by a watch on the glob. Reads of other files, and
+// reads while the watch is being restarted, go to the store.
+type Cache struct {
+	d   Doozer
+	re  *regexp.Regexp
+	max int
+
+	glob string
+	stop chan bool
+	done chan bool
+
+	mu      sync.Mutex
+	w       *Watch
+	live    bool  // the watch is running, so entries are fresh
+	rev     int64 // the watch has applied every change up to rev
+	entries map[string]*list.Element
+	lru     list.List // of *cacheEntry, most recently used first
+	hits    int64
+	misses  int64
+}
+
+type cacheEntry struct {
+	path string
+	body []byte
+	rev  int64
+	at   int64 // the store revision body and rev are as of
+}
+
+// CacheStats holds counters describing a Cache.
+type CacheStats struct {
+	Hits    int64
+	Misses  int64
+	Entries int
+}
+
+// NewCache returns a Cache of at most max files matching glob,
+// read through d. A max of zero or less means no limit.
+func NewCache(d Doozer, glob string, max int) (*Cache, error) {
+	re, err := compileGlob(glob)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Cache{
+		d:       d,
+		re:      re,
+		max:     max,
+		glob:    glob,
+		stop:    make(chan bool),
+		done:    make(chan bool),
+		entries: make(map[string]*list.Element),
+	}
+	go c.run()
+	return c, nil
+}
+
+// Get returns the body and revision of file at the current revision,
+// like Doozer.Get with a nil rev. A file that does not exist has
+// revision 0. The body may be shared with other callers, and must
+// not be modified.
+func (c *Cache) Get(file string) ([]byte, int64, error) {
+	if !c.re.MatchString(file) {
+		body, rev, err := c.d.Get(file, nil)
+		return body, rev, err
+	}
+
+	c.mu.Lock()
+	if e, ok := c.entries[file]; ok && c.live {
+		c.lru.MoveToFront(e)
+		c.hits++
+		ce := e.Value.(*cacheEntry)
+		c.mu.Unlock()
+		return ce.body, ce.rev, nil
+	}
+	c.misses++
+	c.mu.Unlock()
+
+	// Read at a known revision, so we can tell
+	// whether the watch has moved past it.
+	rev, err := c.d.Rev()
+	if err != nil {
+		return nil, 0, err
+	}
+	body, frev, err := c.d.Get(file, &rev)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	c.mu.Lock()
+	if c.live && c.rev <= rev {
+		// The watch will apply any change after rev.
+		c.add(&cacheEntry{file, body, frev, rev})
+	}
+	c.mu.Unlock()
+	return body, frev, nil
+}
+
+// Stats returns a snapshot of c's counters.
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheStats{c.hits, c.misses, len(c.entries)}
+}
+
+// Close stops c's watch and empties c.
+func (c *Cache) Close() {
+	close(c.stop)
+	c.mu.Lock()
+	if c.w != nil {
+		c.w.Cancel()
+	}
+	c.mu.Unlock()
+	<-c.done
+	c.reset()
+}
+
+// add puts ce in c, evicting the least recently used entry
+// if c is full. c.mu must be held.
+func (c *Cache) add(ce *cacheEntry) {
+	if e, ok := c.entries[ce.path]; ok {
+		e.Value = ce
+		c.lru.MoveToFront(e)
+		return
+	}
+	c.entries[ce.path] = c.lru.PushFront(ce)
+	if c.max > 0 && len(c.entries) > c.max {
+		e := c.lru.Back()
+		c.lru.Remove(e)
+		delete(c.entries, e.Value.(*cacheEntry).path)
+	}
+}
+
+// apply updates the entry for ev.Path, if there is one and
+// it is older than ev. An entry read by Get may be newer, if
+// the watch is behind.
+func (c *Cache) apply(ev *Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rev = ev.Rev
+	if e, ok := c.entries[ev.Path]; ok {
+		ce := e.Value.(*cacheEntry)
+		if ev.Rev <= ce.at {
+			return
+		}
+		if ev.IsDel() {
+			e.Value = &cacheEntry{ce.path, nil, missing, ev.Rev}
+		} else {
+			e.Value = &cacheEntry{ce.path, ev.Body, ev.Rev, ev.Rev}
+		}
+	}
+}
+
+// reset empties c and marks it stale.
+func (c *Cache) reset() {
+	c.mu.Lock()
+	c.live = false
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+	c.mu.Unlock()
+}
+
+// run keeps a watch on c's glob, restarting it from
+// the current revision, with an empty cache, if it fails.
+func (c *Cache) run() {
+	defer close(c.done)
+	for {
+		rev, err := c.d.Rev()
+		if err == nil {
+			c.watch(rev)
+		}
+
+		c.reset()
+		select {
+		case <-c.stop:
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// watch applies changes after rev until the watch fails
+// or c is closed.
+func (c *Cache) watch(rev int64) {
+	w := NewWatch(c.d, c.glob, rev+1)
+	c.mu.Lock()
+	select {
+	case <-c.stop:
+		c.mu.Unlock()
+		return
+	default:
+	}
+	c.w = w
+	c.rev = rev
+	c.live = true
+	c.mu.Unlock()
+
+	for {
+		ev, err := w.Next()
+		if err != nil {
+			return
+		}
+		c.apply(ev)
+	}
+}
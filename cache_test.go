@@ -0,0 +1,100 @@
+package doozer
+
+import (
+	"testing"
+)
+
+func TestCacheFresh(t *testing.T) {
+	s := newServer(t)
+	w, r := dialServer(t, s), dialServer(t, s)
+
+	ca, err := NewCache(r, "/cfg/**", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ca.Close()
+	settle(func() bool { return r.Stats().Watches == 1 })
+
+	rev, err := w.Set("/cfg/a", clobber, []byte("1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, frev, err := ca.Get("/cfg/a")
+	if err != nil || string(body) != "1" || frev != rev {
+		t.Fatalf("Get: %q %d %v", body, frev, err)
+	}
+	body, _, _ = ca.Get("/cfg/a")
+	if string(body) != "1" || ca.Stats().Hits != 1 {
+		t.Fatalf("second Get: %q, %+v", body, ca.Stats())
+	}
+
+	rev, err = w.Set("/cfg/a", clobber, []byte("2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !settle(func() bool {
+		body, frev, _ := ca.Get("/cfg/a")
+		return string(body) == "2" && frev == rev
+	}) {
+		t.Fatal("cache never saw the new value")
+	}
+
+	if err := w.Del("/cfg/a", clobber); err != nil {
+		t.Fatal(err)
+	}
+	if !settle(func() bool {
+		body, frev, _ := ca.Get("/cfg/a")
+		return body == nil && frev == missing
+	}) {
+		t.Fatal("cache never saw the delete")
+	}
+
+	// Files outside the glob are read from the store each time.
+	w.Set("/other", clobber, []byte("x"))
+	st := ca.Stats()
+	body, _, _ = ca.Get("/other")
+	if string(body) != "x" || ca.Stats() != st {
+		t.Fatalf("Get outside the glob: %q, %+v", body, ca.Stats())
+	}
+}
+
+func TestCacheSkipsOldEvents(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+
+	ca, err := NewCache(c, "/cfg/**", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ca.Close()
+
+	// As if Get read the files at rev 10 while the watch
+	// was still at rev 4.
+	ca.mu.Lock()
+	ca.add(&cacheEntry{"/cfg/a", []byte("new"), 9, 10})
+	ca.add(&cacheEntry{"/cfg/b", nil, missing, 10})
+	ca.mu.Unlock()
+
+	ca.apply(&Event{Rev: 5, Path: "/cfg/a", Body: []byte("old"), Flag: set})
+	ca.apply(&Event{Rev: 6, Path: "/cfg/b", Body: []byte("gone"), Flag: set})
+	ca.apply(&Event{Rev: 9, Path: "/cfg/a", Flag: del})
+
+	ca.mu.Lock()
+	a := ca.entries["/cfg/a"].Value.(*cacheEntry)
+	b := ca.entries["/cfg/b"].Value.(*cacheEntry)
+	ca.mu.Unlock()
+	if string(a.body) != "new" || a.rev != 9 {
+		t.Fatalf("/cfg/a: %q %d, want %q 9", a.body, a.rev, "new")
+	}
+	if b.body != nil || b.rev != missing {
+		t.Fatalf("/cfg/b: %q %d, want missing", b.body, b.rev)
+	}
+
+	ca.apply(&Event{Rev: 11, Path: "/cfg/a", Body: []byte("newer"), Flag: set})
+	ca.mu.Lock()
+	a = ca.entries["/cfg/a"].Value.(*cacheEntry)
+	ca.mu.Unlock()
+	if string(a.body) != "newer" || a.rev != 11 {
+		t.Fatalf("/cfg/a after a newer event: %q %d", a.body, a.rev)
+	}
+}
@@ -0,0 +1,127 @@
+package doozer
+
+import (
+	"strconv"
+)
+
+// A CalEvent describes who holds a CAL slot, as of revision Rev.
+// A slot is vacant when its file in /ctl/cal is empty or gone.
+type CalEvent struct {
+	Rev    int64
+	Slot   int
+	NodeId string // empty if Vacant
+	Addr   string // the node's address from /ctl/node/<NodeId>/addr
+	Vacant bool
+}
+
+// A CalWatcher reports the holder of every CAL slot, then each
+// change to a slot, read one at a time with Next.
+type CalWatcher struct {
+	c       *Conn
+	w       *Watch
+	pending []CalEvent
+}
+
+// WatchCals returns a CalWatcher whose first events give the state
+// of each slot in /ctl/cal at the current revision, and whose later
+// events follow each change from there.
+func (c *Conn) WatchCals() (*CalWatcher, error) {
+	rev, err := c.Rev()
+	if err != nil {
+		return nil, err
+	}
+
+	evs, err := c.readCals(rev)
+	if err != nil {
+		return nil, err
+	}
+	for i := range evs {
+		if err := c.calAddr(&evs[i]); err != nil {
+			return nil, err
+		}
+	}
+	return &CalWatcher{c: c, w: c.Watch("/ctl/cal/*", rev+1), pending: evs}, nil
+}
+
+// Next returns the next CalEvent. Files in /ctl/cal whose names
+// are not slot numbers are skipped. After Cancel, Next returns
+// io.EOF; see Watch.Next.
+func (cw *CalWatcher) Next() (*CalEvent, error) {
+	if len(cw.pending) > 0 {
+		ev := cw.pending[0]
+		cw.pending = cw.pending[1:]
+		return &ev, nil
+	}
+
+	for {
+		e, err := cw.w.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var body []byte
+		if e.IsSet() {
+			body = e.Body
+		}
+		ev, ok := calSlot(e.Rev, e.Name, body)
+		if !ok {
+			continue
+		}
+		if err := cw.c.calAddr(&ev); err != nil {
+			return nil, err
+		}
+		return &ev, nil
+	}
+}
+
+// Cancel stops cw, as Watch.Cancel does.
+func (cw *CalWatcher) Cancel() {
+	cw.w.Cancel()
+}
+
+// readCals reads the holder of every slot in /ctl/cal at rev,
+// leaving Addr empty. It is the one reader of /ctl/cal, behind
+// both WatchCals and calSlots.
+func (c *Conn) readCals(rev int64) ([]CalEvent, error) {
+	names, err := getdirOpt(c, "/ctl/cal", rev)
+	if err != nil {
+		return nil, err
+	}
+
+	var evs []CalEvent
+	for _, name := range names {
+		body, _, err := c.Get("/ctl/cal/"+name, &rev)
+		if err != nil {
+			return nil, err
+		}
+		if ev, ok := calSlot(rev, name, body); ok {
+			evs = append(evs, ev)
+		}
+	}
+	return evs, nil
+}
+
+// calSlot decodes the CAL file name, holding body at rev.
+// It returns false if name is not a slot number.
+func calSlot(rev int64, name string, body []byte) (CalEvent, bool) {
+	slot, err := strconv.Atoi(name)
+	if err != nil {
+		return CalEvent{}, false
+	}
+	ev := CalEvent{Rev: rev, Slot: slot, NodeId: string(body)}
+	ev.Vacant = ev.NodeId == ""
+	return ev, true
+}
+
+// calAddr fills in ev.Addr, as of ev.Rev, if the slot is held.
+func (c *Conn) calAddr(ev *CalEvent) error {
+	if ev.Vacant {
+		return nil
+	}
+	addr, _, err := c.Get("/ctl/node/"+ev.NodeId+"/addr", &ev.Rev)
+	if err != nil {
+		return err
+	}
+	ev.Addr = string(addr)
+	return nil
+}
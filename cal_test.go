@@ -0,0 +1,103 @@
+package doozer
+
+import (
+	"io"
+	"testing"
+)
+
+func TestWatchCals(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+	setCluster(t, c)
+	if _, err := c.Set("/ctl/cal/notes", clobber, []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+
+	cw, err := c.WatchCals()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cw.Cancel()
+
+	next := func(what string) *CalEvent {
+		ev, err := cw.Next()
+		if err != nil {
+			t.Fatalf("%s: %v", what, err)
+		}
+		return ev
+	}
+
+	// The initial state: slot 0 held by a, slot 1 vacant,
+	// and the file that isn't a slot skipped.
+	ev := next("slot 0")
+	if ev.Slot != 0 || ev.NodeId != "a" || ev.Addr != "10.0.0.1:8046" || ev.Vacant {
+		t.Fatalf("slot 0: %+v", ev)
+	}
+	ev = next("slot 1")
+	if ev.Slot != 1 || ev.NodeId != "" || ev.Addr != "" || !ev.Vacant {
+		t.Fatalf("slot 1: %+v", ev)
+	}
+
+	// Slot 0 goes vacant, by being emptied, then by being deleted,
+	// and is refilled by b.
+	r1, err := c.Set("/ctl/cal/0", clobber, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Del("/ctl/cal/0", clobber); err != nil {
+		t.Fatal(err)
+	}
+	r3, err := c.Set("/ctl/cal/0", clobber, []byte("b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ev = next("emptied")
+	if ev.Slot != 0 || !ev.Vacant || ev.NodeId != "" || ev.Rev != r1 {
+		t.Fatalf("emptied slot: %+v", ev)
+	}
+	ev = next("deleted")
+	if ev.Slot != 0 || !ev.Vacant || ev.NodeId != "" {
+		t.Fatalf("deleted slot: %+v", ev)
+	}
+	ev = next("refilled")
+	if ev.Slot != 0 || ev.Vacant || ev.NodeId != "b" || ev.Addr != "10.0.0.2:8046" || ev.Rev != r3 {
+		t.Fatalf("refilled slot: %+v", ev)
+	}
+
+	// Nodes reads /ctl/cal the same way.
+	n, err := c.NodeInfo("b", nil)
+	if err != nil || n.Slot != "0" {
+		t.Fatalf("NodeInfo(b) after the refill: %+v %v", n, err)
+	}
+	n, err = c.NodeInfo("a", nil)
+	if err != nil || n.Slot != "" {
+		t.Fatalf("NodeInfo(a) after losing its slot: %+v %v", n, err)
+	}
+
+	cw.Cancel()
+	if _, err := cw.Next(); err != io.EOF {
+		t.Fatalf("Next after Cancel: %v, want io.EOF", err)
+	}
+}
+
+func TestWatchCalsEmpty(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+
+	cw, err := c.WatchCals()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cw.Cancel()
+	if _, err := c.Set("/ctl/node/n/addr", clobber, []byte("10.0.0.9:8046")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Set("/ctl/cal/3", clobber, []byte("n")); err != nil {
+		t.Fatal(err)
+	}
+	ev, err := cw.Next()
+	if err != nil || ev.Slot != 3 || ev.NodeId != "n" || ev.Addr != "10.0.0.9:8046" {
+		t.Fatalf("first slot filled: %+v %v", ev, err)
+	}
+}
@@ -0,0 +1,192 @@
+package doozer
+
+import (
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+)
+
+var (
+	ErrBadManifest = errors.New("bad manifest")
+	ErrChecksum    = errors.New("checksum mismatch")
+)
+
+// A chunked file is stored as a manifest at its path, holding
+//
+//	<gen> <count> <length> <sha1>
+//
+// and count chunks at <path>.chunks/<gen>/<index>, where gen names
+// one write of the file, index is zero-padded to 8 digits, length is
+// the total length of the body, and sha1 is the hex SHA-1 of the body.
+
+// DefaultChunkSize is the chunk size WriteFile uses if given none.
+const DefaultChunkSize = 64 << 10
+
+func chunkDir(path string) string {
+	return path + ".chunks"
+}
+
+func chunkPath(path, gen string, i int) string {
+	return fmt.Sprintf("%s/%s/%08d", chunkDir(path), gen, i)
+}
+
+type manifest struct {
+	gen    string
+	count  int
+	length int64
+	sum    string
+}
+
+func parseManifest(body []byte) (m manifest, err error) {
+	_, err = fmt.Sscanf(string(body), "%s %d %d %s", &m.gen, &m.count, &m.length, &m.sum)
+	if err != nil || m.count < 0 {
+		return m, ErrBadManifest
+	}
+	return m, nil
+}
+
+// WriteFile stores the contents of r at path as a chunked file,
+// in chunks of up to chunkSize bytes, so its size is not limited by
+// the largest value the server accepts. A chunkSize of zero or less
+// means DefaultChunkSize. It writes every chunk before
+// setting the manifest, and sets the manifest only if it has not
+// changed since WriteFile began, so readers never see a partial file.
+// WriteFile returns the revision of the new manifest.
+// If it fails, chunks it wrote are left behind for Scrub.
+func (c *Conn) WriteFile(path string, r io.Reader, chunkSize int) (int64, error) {
+	if chunkSize < 1 {
+		chunkSize = DefaultChunkSize
+	}
+
+	_, oldRev, err := c.Get(path, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	m := manifest{gen: fmt.Sprintf("%016x", rand.Int63())}
+	h := sha1.New()
+	buf := make([]byte, chunkSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			_, err := c.Set(chunkPath(path, m.gen, m.count), clobber, buf[:n])
+			if err != nil {
+				return 0, err
+			}
+			h.Write(buf[:n])
+			m.count++
+			m.length += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	m.sum = fmt.Sprintf("%x", h.Sum(nil))
+	body := fmt.Sprintf("%s %d %d %s\n", m.gen, m.count, m.length, m.sum)
+	return c.Set(path, oldRev, []byte(body))
+}
+
+// ReadFile writes the contents of the chunked file at path,
+// as of store revision *rev, to w, and verifies its checksum.
+// If rev is nil, uses the current revision.
+// If the checksum does not match, ReadFile returns ErrChecksum
+// after writing the whole body.
+func (c *Conn) ReadFile(path string, w io.Writer, rev *int64) error {
+	if rev == nil {
+		r, err := c.Rev()
+		if err != nil {
+			return err
+		}
+		rev = &r
+	}
+
+	body, frev, err := c.Get(path, rev)
+	if err != nil {
+		return err
+	}
+	if frev == missing {
+		return &Error{Err: ErrNoEnt, Detail: path}
+	}
+
+	m, err := parseManifest(body)
+	if err != nil {
+		return err
+	}
+
+	h := sha1.New()
+	var n int64
+	for i := 0; i < m.count; i++ {
+		chunk, _, err := c.Get(chunkPath(path, m.gen, i), rev)
+		if err != nil {
+			return err
+		}
+		h.Write(chunk)
+		n += int64(len(chunk))
+		_, err = w.Write(chunk)
+		if err != nil {
+			return err
+		}
+	}
+
+	if n != m.length || fmt.Sprintf("%x", h.Sum(nil)) != m.sum {
+		return ErrChecksum
+	}
+	return nil
+}
+
+// Scrub deletes the chunks under path that the current manifest
+// does not refer to, such as those left by a failed WriteFile.
+// It must not run at the same time as a WriteFile of path,
+// whose new chunks it would delete.
+func (c *Conn) Scrub(path string) error {
+	rev, err := c.Rev()
+	if err != nil {
+		return err
+	}
+
+	body, frev, err := c.Get(path, &rev)
+	if err != nil {
+		return err
+	}
+
+	var keep string
+	if frev != missing {
+		m, err := parseManifest(body)
+		if err != nil {
+			return err
+		}
+		keep = m.gen
+	}
+
+	dir := chunkDir(path)
+	gens, err := c.Getdir(dir, rev, 0, -1)
+	if isErr(err, ErrNoEnt) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, gen := range gens {
+		if gen == keep {
+			continue
+		}
+		names, err := c.Getdir(dir+"/"+gen, rev, 0, -1)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			err = c.Del(dir+"/"+gen+"/"+name, clobber)
+			if err != nil && !isErr(err, ErrNoEnt) {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package doozer
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestChunkedFile(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+
+	body := bytes.Repeat([]byte("0123456789"), 25)
+	for _, size := range []int{1, 7, 100, 250, 1000, 0, -1} {
+		if _, err := c.WriteFile("/big", bytes.NewReader(body), size); err != nil {
+			t.Fatalf("WriteFile, chunk size %d: %v", size, err)
+		}
+		var b bytes.Buffer
+		if err := c.ReadFile("/big", &b, nil); err != nil || !bytes.Equal(b.Bytes(), body) {
+			t.Fatalf("ReadFile, chunk size %d: %d bytes, %v", size, b.Len(), err)
+		}
+	}
+
+	// A chunk size of zero or less means the default, not one byte.
+	m := readManifest(t, c, "/big")
+	if m.count != 1 {
+		t.Fatalf("chunks with the default size: %d, want 1", m.count)
+	}
+
+	if _, err := c.WriteFile("/empty", strings.NewReader(""), 10); err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if err := c.ReadFile("/empty", &b, nil); err != nil || b.Len() != 0 {
+		t.Fatalf("ReadFile of an empty file: %q %v", b.Bytes(), err)
+	}
+
+	err := c.ReadFile("/none", &b, nil)
+	if !isErr(err, ErrNoEnt) {
+		t.Fatalf("ReadFile of a missing file: %v, want ErrNoEnt", err)
+	}
+}
+
+func readManifest(t *testing.T, c *Conn, path string) manifest {
+	body, _, err := c.Get(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := parseManifest(body)
+	if err != nil {
+		t.Fatalf("%s: %q: %v", path, body, err)
+	}
+	return m
+}
+
+// interfering is a Reader that runs f before its first read.
+type interfering struct {
+	r    io.Reader
+	f    func()
+	done bool
+}
+
+func (r *interfering) Read(p []byte) (int, error) {
+	if !r.done {
+		r.done = true
+		r.f()
+	}
+	return r.r.Read(p)
+}
+
+func TestWriteFileConflict(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+	other := dialServer(t, s)
+
+	if _, err := c.WriteFile("/f", strings.NewReader("first"), 2); err != nil {
+		t.Fatal(err)
+	}
+	winner := readManifest(t, c, "/f")
+
+	// Another writer replaces the file while the chunks are written.
+	r := &interfering{r: strings.NewReader("loser's body"), f: func() {
+		if _, err := other.WriteFile("/f", strings.NewReader("second"), 2); err != nil {
+			t.Error(err)
+		}
+		winner = readManifest(t, other, "/f")
+	}}
+	_, err := c.WriteFile("/f", r, 2)
+	if !IsConflict(err) {
+		t.Fatalf("WriteFile racing another: %v, want a conflict", err)
+	}
+	if m := readManifest(t, c, "/f"); m != winner {
+		t.Fatalf("manifest: %+v, want the winner's %+v", m, winner)
+	}
+	var b bytes.Buffer
+	if err := c.ReadFile("/f", &b, nil); err != nil || b.String() != "second" {
+		t.Fatalf("ReadFile after the conflict: %q %v", b.String(), err)
+	}
+}
+
+func TestReadFileChecksum(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+
+	if _, err := c.WriteFile("/f", strings.NewReader("abcdef"), 2); err != nil {
+		t.Fatal(err)
+	}
+	m := readManifest(t, c, "/f")
+
+	// The same length, other bytes.
+	if _, err := c.Set(chunkPath("/f", m.gen, 1), clobber, []byte("XY")); err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if err := c.ReadFile("/f", &b, nil); err != ErrChecksum {
+		t.Fatalf("ReadFile of a changed chunk: %v, want ErrChecksum", err)
+	}
+	if b.String() != "abXYef" {
+		t.Fatalf("body written before the check: %q", b.String())
+	}
+
+	// A missing chunk changes the length.
+	if err := c.Del(chunkPath("/f", m.gen, 2), clobber); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ReadFile("/f", ioutil.Discard, nil); err != ErrChecksum {
+		t.Fatalf("ReadFile with a chunk missing: %v, want ErrChecksum", err)
+	}
+
+	if _, err := c.Set("/f", clobber, []byte("garbage")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ReadFile("/f", ioutil.Discard, nil); err != ErrBadManifest {
+		t.Fatalf("ReadFile of a bad manifest: %v, want ErrBadManifest", err)
+	}
+}
+
+func TestScrub(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+
+	var gens []string
+	for _, body := range []string{"one one", "two two", "three three"} {
+		if _, err := c.WriteFile("/f", strings.NewReader(body), 3); err != nil {
+			t.Fatal(err)
+		}
+		gens = append(gens, readManifest(t, c, "/f").gen)
+	}
+	if err := c.Scrub("/f"); err != nil {
+		t.Fatal(err)
+	}
+
+	rev, _ := c.Rev()
+	left, err := c.Getdir(chunkDir("/f"), rev, 0, -1)
+	if err != nil || len(left) != 1 || left[0] != gens[2] {
+		t.Fatalf("generations after Scrub: %v %v, want only %s", left, err, gens[2])
+	}
+	var b bytes.Buffer
+	if err := c.ReadFile("/f", &b, nil); err != nil || b.String() != "three three" {
+		t.Fatalf("ReadFile after Scrub: %q %v", b.String(), err)
+	}
+
+	// With no manifest, every generation goes.
+	if err := c.Del("/f", clobber); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Scrub("/f"); err != nil {
+		t.Fatal(err)
+	}
+	rev, _ = c.Rev()
+	if left, err := c.Getdir(chunkDir("/f"), rev, 0, -1); !isErr(err, ErrNoEnt) {
+		t.Fatalf("chunks after Scrub of a deleted file: %v %v", left, err)
+	}
+	if err := c.Scrub("/nothing"); err != nil {
+		t.Fatalf("Scrub with no chunks: %v", err)
+	}
+}
@@ -0,0 +1,190 @@
+package doozer
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"text/tabwriter"
+)
+
+// A ClusterInfo describes the nodes of a doozer cluster,
+// as recorded under /ctl at revision Rev.
+type ClusterInfo struct {
+	Rev   int64
+	Nodes []NodeInfo
+}
+
+// A NodeInfo describes one node of a doozer cluster, as recorded
+// in the files under /ctl/node/<Id>. A field whose file is missing,
+// as with older versions of doozerd, is left zero, as is Applied if
+// its file doesn't hold a number.
+type NodeInfo struct {
+	Id       string // name of the node's directory in /ctl/node
+	Addr     string
+	Hostname string
+	Version  string
+	Applied  int64 // the last revision the node has applied
+
+	// Slot is the name of the file in /ctl/cal naming this node,
+	// or "" if the node holds no CAL slot.
+	Slot string
+}
+
+// ClusterInfo reads the description of every node in the cluster,
+// as Nodes does, at the current revision.
+func (c *Conn) ClusterInfo() (*ClusterInfo, error) {
+	rev, err := c.Rev()
+	if err != nil {
+		return nil, err
+	}
+
+	nodes, err := c.Nodes(&rev)
+	if err != nil {
+		return nil, err
+	}
+	return &ClusterInfo{Rev: rev, Nodes: nodes}, nil
+}
+
+// Nodes reads the description of every node in /ctl/node,
+// at revision *rev, or the current revision if rev is nil.
+func (c *Conn) Nodes(rev *int64) ([]NodeInfo, error) {
+	r, err := c.pinRev(rev)
+	if err != nil {
+		return nil, err
+	}
+
+	slots, err := c.calSlots(r)
+	if err != nil {
+		return nil, err
+	}
+
+	ids, err := getdirOpt(c, "/ctl/node", r)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make([]NodeInfo, len(ids))
+	for i, id := range ids {
+		nodes[i] = NodeInfo{Id: id, Slot: slots[id]}
+		err = c.readNode(&nodes[i], r)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nodes, nil
+}
+
+// NodeInfo reads the description of node id, at revision *rev,
+// or the current revision if rev is nil.
+func (c *Conn) NodeInfo(id string, rev *int64) (*NodeInfo, error) {
+	r, err := c.pinRev(rev)
+	if err != nil {
+		return nil, err
+	}
+
+	slots, err := c.calSlots(r)
+	if err != nil {
+		return nil, err
+	}
+
+	n := &NodeInfo{Id: id, Slot: slots[id]}
+	err = c.readNode(n, r)
+	if err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// readNode fills in n from the files in /ctl/node/<n.Id> at rev.
+func (c *Conn) readNode(n *NodeInfo, rev int64) error {
+	dir := "/ctl/node/" + n.Id + "/"
+	files := []struct {
+		name string
+		p    *string
+	}{
+		{"addr", &n.Addr},
+		{"hostname", &n.Hostname},
+		{"version", &n.Version},
+	}
+	for _, f := range files {
+		body, _, err := c.Get(dir+f.name, &rev)
+		if err != nil {
+			return err
+		}
+		*f.p = string(body)
+	}
+
+	body, _, err := c.Get(dir+"applied", &rev)
+	if err != nil {
+		return err
+	}
+	// A bad applied file leaves Applied zero, rather than
+	// failing the read of every node in the cluster.
+	n.Applied, _ = strconv.ParseInt(string(body), 10, 64)
+	return nil
+}
+
+// pinRev returns *rev, or the current revision if rev is nil.
+func (c *Conn) pinRev(rev *int64) (int64, error) {
+	if rev != nil {
+		return *rev, nil
+	}
+	return c.Rev()
+}
+
+// calSlots returns a map from node id to the /ctl/cal slot
+// it holds at rev.
+func (c *Conn) calSlots(rev int64) (map[string]string, error) {
+	evs, err := c.readCals(rev)
+	if err != nil {
+		return nil, err
+	}
+
+	slots := make(map[string]string)
+	for _, ev := range evs {
+		if !ev.Vacant {
+			slots[ev.NodeId] = strconv.Itoa(ev.Slot)
+		}
+	}
+	return slots, nil
+}
+
+// getdirOpt acts like d.Getdir reading all of dir,
+// but treats a missing dir as empty.
+func getdirOpt(d Doozer, dir string, rev int64) ([]string, error) {
+	names, err := d.Getdir(dir, rev, 0, -1)
+	if isErr(err, ErrNoEnt) {
+		return nil, nil
+	}
+	return names, err
+}
+
+// getdirinfoOpt acts like Getdirinfo reading all of dir,
+// but treats a missing dir as empty.
+func (c *Conn) getdirinfoOpt(dir string, rev int64) ([]FileInfo, error) {
+	if dir == "" {
+		dir = "/"
+	}
+	list, err := c.Getdirinfo(dir, rev, 0, -1)
+	if isErr(err, ErrNoEnt) {
+		return nil, nil
+	}
+	return list, err
+}
+
+// String formats ci as a table, one line per node.
+func (ci *ClusterInfo) String() string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "rev %d\n", ci.Rev)
+	w := tabwriter.NewWriter(&b, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tADDR\tHOSTNAME\tAPPLIED\tCAL")
+	for _, n := range ci.Nodes {
+		slot := n.Slot
+		if slot == "" {
+			slot = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", n.Id, n.Addr, n.Hostname, n.Applied, slot)
+	}
+	w.Flush()
+	return b.String()
+}
@@ -0,0 +1,183 @@
+package doozer
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ha/doozer/doozertest"
+)
+
+// setCluster writes /ctl for three nodes: a, complete and in CAL
+// slot 0; b, whose applied file is garbage; and c, which has only
+// an addr. CAL slot 1 is vacant.
+func setCluster(t *testing.T, c *Conn) {
+	files := []struct{ path, body string }{
+		{"/ctl/node/a/addr", "10.0.0.1:8046"},
+		{"/ctl/node/a/hostname", "alpha"},
+		{"/ctl/node/a/version", "0.8"},
+		{"/ctl/node/a/applied", "42"},
+		{"/ctl/node/b/addr", "10.0.0.2:8046"},
+		{"/ctl/node/b/applied", "junk"},
+		{"/ctl/node/c/addr", "10.0.0.3:8046"},
+		{"/ctl/cal/0", "a"},
+		{"/ctl/cal/1", ""},
+	}
+	for _, f := range files {
+		if _, err := c.Set(f.path, clobber, []byte(f.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestNodes(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+	setCluster(t, c)
+
+	nodes, err := c.Nodes(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []NodeInfo{
+		{Id: "a", Addr: "10.0.0.1:8046", Hostname: "alpha", Version: "0.8", Applied: 42, Slot: "0"},
+		{Id: "b", Addr: "10.0.0.2:8046"},
+		{Id: "c", Addr: "10.0.0.3:8046"},
+	}
+	if len(nodes) != len(want) {
+		t.Fatalf("Nodes: %+v", nodes)
+	}
+	for i := range want {
+		if nodes[i] != want[i] {
+			t.Errorf("node %d: %+v, want %+v", i, nodes[i], want[i])
+		}
+	}
+
+	n, err := c.NodeInfo("b", nil)
+	if err != nil || *n != want[1] {
+		t.Fatalf("NodeInfo(b): %+v %v", n, err)
+	}
+}
+
+func TestNodesAtRev(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+	setCluster(t, c)
+
+	rev, err := c.Rev()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Set("/ctl/node/a/applied", clobber, []byte("43")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Set("/ctl/cal/1", clobber, []byte("b")); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := c.NodeInfo("a", &rev)
+	if err != nil || n.Applied != 42 {
+		t.Fatalf("NodeInfo(a) at %d: %+v %v", rev, n, err)
+	}
+	n, err = c.NodeInfo("b", nil)
+	if err != nil || n.Slot != "1" {
+		t.Fatalf("NodeInfo(b) after it took a slot: %+v %v", n, err)
+	}
+}
+
+func TestNodesEmpty(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+
+	nodes, err := c.Nodes(nil)
+	if err != nil || len(nodes) != 0 {
+		t.Fatalf("Nodes with no /ctl: %+v %v", nodes, err)
+	}
+}
+
+func TestClusterInfo(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+	setCluster(t, c)
+
+	rev, err := c.Rev()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ci, err := c.ClusterInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ci.Rev != rev || len(ci.Nodes) != 3 {
+		t.Fatalf("ClusterInfo: %+v", ci)
+	}
+
+	lines := strings.Split(strings.TrimSpace(ci.String()), "\n")
+	if len(lines) != 5 || lines[0] != "rev "+strconv.FormatInt(rev, 10) {
+		t.Fatalf("String:\n%s", ci)
+	}
+	for i, want := range [][]string{
+		{"ID", "ADDR", "HOSTNAME", "APPLIED", "CAL"},
+		{"a", "10.0.0.1:8046", "alpha", "42", "0"},
+		{"b", "10.0.0.2:8046", "0", "-"},
+		{"c", "10.0.0.3:8046", "0", "-"},
+	} {
+		if got := strings.Fields(lines[i+1]); strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Errorf("line %d: %q, want fields %q", i+1, lines[i+1], want)
+		}
+	}
+}
+
+// TestClusterInfoPinned changes the cluster while ClusterInfo is
+// partway through reading it. The result must be the cluster as of
+// the rev it reports, with none of the changes.
+func TestClusterInfoPinned(t *testing.T) {
+	s, err := doozertest.NewUnstartedServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	other := make(chan *Conn, 1)
+	var once sync.Once
+	s.Fail = func(verb, path string) error {
+		if verb == "GET" && path == "/ctl/node/a/addr" {
+			once.Do(func() {
+				o := <-other
+				for _, f := range []struct{ path, body string }{
+					{"/ctl/node/b/addr", "10.9.9.9:8046"},
+					{"/ctl/cal/1", "b"},
+					{"/ctl/node/d/addr", "10.0.0.4:8046"},
+				} {
+					if _, err := o.Set(f.path, clobber, []byte(f.body)); err != nil {
+						t.Error(err)
+					}
+				}
+			})
+		}
+		return nil
+	}
+	s.Start()
+	c := dialServer(t, s)
+	setCluster(t, c)
+	other <- dialServer(t, s)
+
+	ci, err := c.ClusterInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ci.Nodes) != 3 {
+		t.Fatalf("nodes: %+v, want a, b and c", ci.Nodes)
+	}
+	if b := ci.Nodes[1]; b.Addr != "10.0.0.2:8046" || b.Slot != "" {
+		t.Fatalf("node b: %+v, want it as of rev %d", b, ci.Rev)
+	}
+
+	ci, err = c.ClusterInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ci.Nodes) != 4 || ci.Nodes[1].Addr != "10.9.9.9:8046" || ci.Nodes[1].Slot != "1" {
+		t.Fatalf("ClusterInfo after the changes: %+v", ci.Nodes)
+	}
+}
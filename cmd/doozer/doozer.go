@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"github.com/ha/doozer"
@@ -16,6 +17,9 @@ var (
 	rrev        = flag.Int64("r", -1, "request rev")
 	showHelp    = flag.Bool("h", false, "show help")
 	showVersion = flag.Bool("v", false, "print version string")
+	encoding    = flag.String("e", "", "print bodies encoded as hex or base64")
+	nulSep      = flag.Bool("0", false, "end watch records with NUL, not LF")
+	asJSON      = flag.Bool("json", false, "print watch and find records as JSON lines")
 )
 
 type cmd struct {
@@ -34,7 +38,9 @@ const (
 	usage1 = `
 Each command takes zero or more options and zero or more arguments.
 In addition, there are some global options that can be used with any command.
-The exit status is 0 on success, 1 for a rev mismatch, and 2 otherwise.
+The exit status is 0 on success, 1 if there is no such file or directory,
+2 for a usage error, 3 if the server can't be reached or the connection
+fails, and 4 for any other error, such as a rev mismatch.
 
 Global Options:
 `
@@ -73,12 +79,49 @@ func usage() {
 
 }
 
+// Exit statuses.
+const (
+	exitNoEnt     = 1
+	exitUsage     = 2
+	exitTransport = 3
+	exitFailure   = 4
+)
+
+// bail reports e and exits. Under flag -json, the report is
+// the last line of output, on stdout; otherwise it goes to stderr.
 func bail(e error) {
-	fmt.Fprintln(os.Stderr, "Error:", e)
-	if e == doozer.ErrOldRev {
-		os.Exit(1)
+	if *asJSON {
+		json.NewEncoder(os.Stdout).Encode(jsonError{e.Error()})
+	} else {
+		fmt.Fprintln(os.Stderr, "Error:", e)
 	}
-	os.Exit(2)
+	os.Exit(exitCode(e))
+}
+
+// exitCode returns the exit status for e.
+func exitCode(e error) int {
+	switch e := e.(type) {
+	case *doozer.Error:
+		if e.Err == doozer.ErrNoEnt {
+			return exitNoEnt
+		}
+		return exitFailure
+	case *strconv.NumError:
+		return exitUsage
+	}
+
+	switch e {
+	case doozer.ErrInvalidUri:
+		return exitUsage
+	case doozer.ErrWaitTimeout:
+		return exitFailure
+	case doozer.ErrClosed:
+		return exitTransport
+	}
+	if doozer.IsTemporary(e) {
+		return exitTransport
+	}
+	return exitFailure
 }
 
 func mustAtoi64(arg string) int64 {
@@ -89,6 +132,14 @@ func mustAtoi64(arg string) int64 {
 	return n
 }
 
+// reqRev returns the rev given by flag -r, or nil if there is none.
+func reqRev() *int64 {
+	if *rrev == -1 {
+		return nil
+	}
+	return rrev
+}
+
 func dial() *doozer.Conn {
 	c, err := doozer.DialUri(*uri, *buri)
 	if err != nil {
@@ -122,7 +173,7 @@ func main() {
 	if flag.NArg() < 1 {
 		fmt.Fprintf(os.Stderr, "%s: missing command\n", os.Args[0])
 		usage()
-		os.Exit(127)
+		os.Exit(exitUsage)
 	}
 
 	cmd := flag.Arg(0)
@@ -131,7 +182,7 @@ func main() {
 	if !ok {
 		fmt.Fprintln(os.Stderr, "Unknown command:", cmd)
 		usage()
-		os.Exit(127)
+		os.Exit(exitUsage)
 	}
 
 	os.Args = flag.Args()
@@ -147,7 +198,7 @@ func main() {
 	if len(args) != ft.NumIn() {
 		fmt.Fprintf(os.Stderr, "%s: wrong number of arguments\n", cmd)
 		help(cmd)
-		os.Exit(127)
+		os.Exit(exitUsage)
 	}
 
 	vals := make([]reflect.Value, len(args))
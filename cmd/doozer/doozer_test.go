@@ -0,0 +1,487 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ha/doozer/doozertest"
+)
+
+// TestMain runs the command itself, not the tests, when the test
+// binary is started by run.
+func TestMain(m *testing.M) {
+	if os.Getenv("DOOZER_TEST_MAIN") != "" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func newServer(t *testing.T) *doozertest.Server {
+	s, err := doozertest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	return s
+}
+
+// command returns an exec.Cmd that runs doozer with args
+// against uri.
+func command(uri, stdin string, args ...string) *exec.Cmd {
+	cmd := exec.Command(os.Args[0], append([]string{"-a", uri}, args...)...)
+	cmd.Env = append(os.Environ(), "DOOZER_TEST_MAIN=1", "DOOZER_URI=", "DOOZER_BOOT_URI=")
+	cmd.Stdin = strings.NewReader(stdin)
+	return cmd
+}
+
+// run runs doozer with args against uri and returns its output
+// and exit status.
+func run(t *testing.T, uri, stdin string, args ...string) (stdout, stderr string, code int) {
+	var o, e bytes.Buffer
+	cmd := command(uri, stdin, args...)
+	cmd.Stdout = &o
+	cmd.Stderr = &e
+	err := cmd.Run()
+	if x, ok := err.(*exec.ExitError); ok {
+		code = x.ExitCode()
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	return o.String(), e.String(), code
+}
+
+func TestCommands(t *testing.T) {
+	s := newServer(t)
+	uri := s.URI()
+
+	tests := []struct {
+		stdin string
+		args  []string
+
+		stdout string
+		code   int
+	}{
+		{"hello", []string{"set", "/a", "0"}, "1\n", 0},
+		{"", []string{"get", "/a"}, "hello", 0},
+		{"", []string{"-e", "hex", "get", "/a"}, "68656c6c6f\n", 0},
+		{"", []string{"stat", "/a"}, "1 5\n", 0},
+		{"", []string{"rev"}, "1\n", 0},
+		{"x", []string{"set", "/d/x", "-1"}, "2\n", 0},
+		{"", []string{"ls", "/"}, "a\nd\n", 0},
+		{"", []string{"stat", "/d"}, "d 1\n", 0},
+		{"", []string{"find", "/d"}, "/d\n/d/x\n", 0},
+		{"", []string{"wait", "-r", "1", "/a"}, "/a 1 set 5\nhello\n", 0},
+
+		// NOENT
+		{"", []string{"get", "/nope"}, "", exitNoEnt},
+		{"", []string{"stat", "/nope"}, "", exitNoEnt},
+		{"", []string{"ls", "/nope"}, "", exitNoEnt},
+
+		// usage
+		{"", []string{}, "", exitUsage},
+		{"", []string{"frob"}, "", exitUsage},
+		{"", []string{"get"}, "", exitUsage},
+		{"", []string{"get", "/a", "/b"}, "", exitUsage},
+		{"", []string{"-nosuchflag", "rev"}, "", exitUsage},
+		{"", []string{"set", "/a", "x"}, "", exitUsage},
+		{"", []string{"-e", "rot13", "get", "/a"}, "", exitUsage},
+
+		// other failures
+		{"again", []string{"set", "/a", "0"}, "", exitFailure},
+		{"", []string{"get", "/d"}, "", exitFailure},
+		{"", []string{"wait", "-t", "10ms", "/nope"}, "", exitFailure},
+
+		{"", []string{"del", "/d/x", "2"}, "", 0},
+		{"", []string{"ls", "/"}, "a\n", 0},
+	}
+	for _, tt := range tests {
+		stdout, stderr, code := run(t, uri, tt.stdin, tt.args...)
+		if code != tt.code {
+			t.Errorf("doozer %s: exit %d, want %d; stderr: %s", strings.Join(tt.args, " "), code, tt.code, stderr)
+			continue
+		}
+		if tt.code == 0 && stdout != tt.stdout {
+			t.Errorf("doozer %s: got %q, want %q", strings.Join(tt.args, " "), stdout, tt.stdout)
+		}
+	}
+}
+
+// TestGetRev checks that get prints the file's revision on stderr,
+// apart from the body on stdout.
+func TestGetRev(t *testing.T) {
+	s := newServer(t)
+	run(t, s.URI(), "one", "set", "/a", "0")
+	run(t, s.URI(), "two", "set", "/a", "1")
+
+	tests := []struct {
+		args           []string
+		stdout, stderr string
+	}{
+		{[]string{"get", "/a"}, "two", "2\n"},
+		{[]string{"-r", "1", "get", "/a"}, "one", "1\n"},
+		{[]string{"-e", "hex", "get", "/a"}, "74776f\n", "2\n"},
+	}
+	for _, tt := range tests {
+		stdout, stderr, code := run(t, s.URI(), "", tt.args...)
+		if code != 0 || stdout != tt.stdout || stderr != tt.stderr {
+			t.Errorf("doozer %s: %q %q, exit %d, want %q %q", strings.Join(tt.args, " "), stdout, stderr, code, tt.stdout, tt.stderr)
+		}
+	}
+
+	_, stderr, code := run(t, s.URI(), "", "get", "/nope")
+	if code != exitNoEnt || stderr != "No such file: /nope\n" {
+		t.Errorf("get of a missing file: %q, exit %d", stderr, code)
+	}
+}
+
+func TestPingCommand(t *testing.T) {
+	s, node := newServer(t), newServer(t)
+	run(t, s.URI(), node.Addr, "set", "/ctl/node/x/addr", "0")
+
+	stdout, stderr, code := run(t, s.URI(), "", "ping")
+	if code != 0 {
+		t.Fatalf("ping: exit %d: %s", code, stderr)
+	}
+	f := strings.Fields(stdout)
+	if len(f) != 2 || f[0] != node.Addr {
+		t.Fatalf("ping: %q, want the node's address and RTT", stdout)
+	}
+	if _, err := time.ParseDuration(f[1]); err != nil {
+		t.Fatalf("ping RTT: %v", err)
+	}
+}
+
+func TestTransportFailure(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	_, _, code := run(t, "doozer:?ca="+addr, "", "rev")
+	if code != exitTransport {
+		t.Fatalf("rev with no server: exit %d, want %d", code, exitTransport)
+	}
+}
+
+func TestWatchDropped(t *testing.T) {
+	s := newServer(t)
+
+	cmd := command(s.URI(), "", "-r", "1", "watch", "/**")
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	run(t, s.URI(), "1", "set", "/w", "-1")
+	line, err := bufio.NewReader(out).ReadString('\n')
+	if err != nil || line != "/w 1 set 1\n" {
+		t.Fatalf("watch output: %q %v", line, err)
+	}
+	s.DropConns()
+
+	err = cmd.Wait()
+	x, ok := err.(*exec.ExitError)
+	if !ok || x.ExitCode() != exitTransport {
+		t.Fatalf("watch after a drop: %v, want exit %d", err, exitTransport)
+	}
+}
+
+// binaryBody returns every byte value, twice, with runs of NULs
+// and newlines between.
+func binaryBody() []byte {
+	var b []byte
+	for i := 0; i < 512; i++ {
+		b = append(b, byte(i))
+	}
+	return append(b, "\x00\x00\n\n\r\n\x00"...)
+}
+
+func TestBinaryRoundTrip(t *testing.T) {
+	s := newServer(t)
+	body := binaryBody()
+
+	_, stderr, code := run(t, s.URI(), string(body), "set", "/bin", "0")
+	if code != 0 {
+		t.Fatalf("set: exit %d: %s", code, stderr)
+	}
+
+	stdout, _, _ := run(t, s.URI(), "", "get", "/bin")
+	if stdout != string(body) {
+		t.Fatalf("get: %d bytes, want %d; no newline may be added", len(stdout), len(body))
+	}
+
+	stdout, _, _ = run(t, s.URI(), "", "-e", "hex", "get", "/bin")
+	if b, err := hex.DecodeString(strings.TrimSuffix(stdout, "\n")); err != nil || !bytes.Equal(b, body) {
+		t.Fatalf("get -e hex: %q %v", stdout, err)
+	}
+	stdout, _, _ = run(t, s.URI(), "", "-e", "base64", "get", "/bin")
+	if b, err := base64.StdEncoding.DecodeString(strings.TrimSuffix(stdout, "\n")); err != nil || !bytes.Equal(b, body) {
+		t.Fatalf("get -e base64: %q %v", stdout, err)
+	}
+
+	// An empty stdin sets an empty file.
+	run(t, s.URI(), "", "set", "/empty", "0")
+	stdout, _, code = run(t, s.URI(), "", "get", "/empty")
+	if stdout != "" || code != 0 {
+		t.Fatalf("get of an empty file: %q, exit %d", stdout, code)
+	}
+}
+
+func TestWatchNUL(t *testing.T) {
+	s := newServer(t)
+	body := binaryBody()
+
+	cmd := command(s.URI(), "", "-0", "-r", "1", "watch", "/**")
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+
+	run(t, s.URI(), string(body), "set", "/a", "0")
+	run(t, s.URI(), "", "del", "/a", "1")
+
+	r := bufio.NewReader(out)
+	for _, want := range []struct {
+		hdr  string
+		body []byte
+	}{
+		{"/a 1 set " + strconv.Itoa(len(body)), body},
+		{"/a 2 del 0", nil},
+	} {
+		hdr, err := r.ReadString(0)
+		if err != nil || hdr != want.hdr+"\x00" {
+			t.Fatalf("header: %q %v, want %q", hdr, err, want.hdr)
+		}
+		got := make([]byte, len(want.body)+1)
+		if _, err := io.ReadFull(r, got); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got[:len(want.body)], want.body) || got[len(want.body)] != 0 {
+			t.Fatalf("body of %q: %q", want.hdr, got)
+		}
+	}
+}
+
+func TestWatchJSON(t *testing.T) {
+	s := newServer(t)
+
+	var stderr bytes.Buffer
+	cmd := command(s.URI(), "", "-json", "-r", "1", "watch", "/**")
+	cmd.Stderr = &stderr
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	run(t, s.URI(), "hi\x00", "set", "/a", "0")
+	run(t, s.URI(), "", "set", "/a", "1")
+	run(t, s.URI(), "", "del", "/a", "2")
+
+	r := bufio.NewReader(out)
+	for _, want := range []map[string]interface{}{
+		{"rev": 1.0, "path": "/a", "flag": "set", "body_b64": "aGkA"},
+		{"rev": 2.0, "path": "/a", "flag": "set", "body_b64": ""},
+		{"rev": 3.0, "path": "/a", "flag": "del", "body_b64": ""},
+	} {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &got); err != nil {
+			t.Fatalf("%q: %v", line, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+
+	s.DropConns()
+	line, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	var e map[string]string
+	if err := json.Unmarshal([]byte(line), &e); err != nil || len(e) != 1 || e["error"] == "" {
+		t.Fatalf("last line: %q %v", line, err)
+	}
+	if rest, _ := ioutil.ReadAll(r); len(rest) > 0 {
+		t.Fatalf("output after the error: %q", rest)
+	}
+
+	err = cmd.Wait()
+	if x, ok := err.(*exec.ExitError); !ok || x.ExitCode() != exitTransport {
+		t.Fatalf("exit: %v, want %d", err, exitTransport)
+	}
+	if stderr.Len() > 0 {
+		t.Fatalf("stderr under -json: %q", stderr.String())
+	}
+}
+
+// TestOutputFlags runs watch and get with each combination of
+// flags -e, -0 and -json. Under -json, bodies are always base64,
+// and -e and -0 have no effect.
+func TestOutputFlags(t *testing.T) {
+	s := newServer(t)
+	run(t, s.URI(), "hi\n\x00", "set", "/a", "0")
+	run(t, s.URI(), "", "del", "/a", "1")
+	run(t, s.URI(), "hi\n\x00", "set", "/b", "0")
+
+	const (
+		jsonOut = `{"rev":1,"path":"/a","flag":"set","body_b64":"aGkKAA=="}` + "\n" +
+			`{"rev":2,"path":"/a","flag":"del","body_b64":""}` + "\n"
+	)
+	tests := []struct {
+		flags []string
+		watch string // first two records of watch -r 1 /a
+		get   string // get /b
+	}{
+		{nil, "/a 1 set 4\nhi\n\x00\n/a 2 del 0\n\n", "hi\n\x00"},
+		{[]string{"-e", "hex"}, "/a 1 set 8\n68690a00\n/a 2 del 0\n\n", "68690a00\n"},
+		{[]string{"-e", "base64"}, "/a 1 set 8\naGkKAA==\n/a 2 del 0\n\n", "aGkKAA==\n"},
+		{[]string{"-0"}, "/a 1 set 4\x00hi\n\x00\x00/a 2 del 0\x00\x00", "hi\n\x00"},
+		{[]string{"-0", "-e", "hex"}, "/a 1 set 8\x0068690a00\x00/a 2 del 0\x00\x00", "68690a00\n"},
+		{[]string{"-0", "-e", "base64"}, "/a 1 set 8\x00aGkKAA==\x00/a 2 del 0\x00\x00", "aGkKAA==\n"},
+		{[]string{"-json"}, jsonOut, "hi\n\x00"},
+		{[]string{"-json", "-e", "hex"}, jsonOut, "68690a00\n"},
+		{[]string{"-json", "-e", "base64"}, jsonOut, "aGkKAA==\n"},
+		{[]string{"-json", "-0"}, jsonOut, "hi\n\x00"},
+		{[]string{"-json", "-0", "-e", "hex"}, jsonOut, "68690a00\n"},
+	}
+	for _, tt := range tests {
+		args := append(tt.flags[:len(tt.flags):len(tt.flags)], "-r", "1", "watch", "/a")
+		if got := watchOutput(t, s.URI(), len(tt.watch), args...); got != tt.watch {
+			t.Errorf("doozer %s: got %q, want %q", strings.Join(args, " "), got, tt.watch)
+		}
+
+		args = append(tt.flags[:len(tt.flags):len(tt.flags)], "get", "/b")
+		stdout, stderr, code := run(t, s.URI(), "", args...)
+		if code != 0 || stdout != tt.get {
+			t.Errorf("doozer %s: %q, exit %d, want %q; stderr: %s", strings.Join(args, " "), stdout, code, tt.get, stderr)
+		}
+	}
+
+	for _, flags := range [][]string{{"-e", "rot13"}, {"-0", "-e", "rot13"}} {
+		args := append(flags, "-r", "1", "watch", "/a")
+		if _, _, code := run(t, s.URI(), "", args...); code != exitUsage {
+			t.Errorf("doozer %s: exit %d, want %d", strings.Join(args, " "), code, exitUsage)
+		}
+	}
+}
+
+// watchOutput runs doozer with args, a watch, and returns
+// the first n bytes it prints.
+func watchOutput(t *testing.T, uri string, n int, args ...string) string {
+	cmd := command(uri, "", args...)
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+	kill := time.AfterFunc(10*time.Second, func() { cmd.Process.Kill() })
+	defer kill.Stop()
+
+	buf := make([]byte, n)
+	n, _ = io.ReadFull(out, buf)
+	return string(buf[:n])
+}
+
+func TestFindJSON(t *testing.T) {
+	s := newServer(t)
+	run(t, s.URI(), "x", "set", "/f/a", "0")
+	run(t, s.URI(), "y", "set", "/f/d/b", "0")
+
+	stdout, stderr, code := run(t, s.URI(), "", "-json", "find", "/f")
+	if code != 0 {
+		t.Fatalf("exit %d: %s", code, stderr)
+	}
+
+	var got []jsonRecord
+	dec := json.NewDecoder(strings.NewReader(stdout))
+	for dec.More() {
+		var r jsonRecord
+		if err := dec.Decode(&r); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, r)
+	}
+	want := []jsonRecord{
+		{Path: "/f", Flag: "set", IsDir: true},
+		{Rev: 1, Path: "/f/a", Flag: "set"},
+		{Path: "/f/d", Flag: "set", IsDir: true},
+		{Rev: 2, Path: "/f/d/b", Flag: "set"},
+	}
+	for i := range got {
+		if got[i].IsDir {
+			got[i].Rev = 0 // a directory's rev is not a file revision
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	if strings.Count(stdout, "\n") != len(want) {
+		t.Fatalf("want one record per line: %q", stdout)
+	}
+}
+
+func TestDumpLoadCommands(t *testing.T) {
+	src, dst := newServer(t), newServer(t)
+	body := binaryBody()
+	run(t, src.URI(), string(body), "set", "/x/bin", "0")
+	run(t, src.URI(), "", "set", "/x/empty", "0")
+	run(t, dst.URI(), "stale", "set", "/x/stale", "0")
+
+	dump, stderr, code := run(t, src.URI(), "", "dump", "/**")
+	if code != 0 {
+		t.Fatalf("dump: exit %d: %s", code, stderr)
+	}
+	_, stderr, code = run(t, dst.URI(), dump, "load", "-x", "")
+	if code != 0 {
+		t.Fatalf("load: exit %d: %s", code, stderr)
+	}
+
+	stdout, _, _ := run(t, dst.URI(), "", "find", "/x")
+	if stdout != "/x\n/x/bin\n/x/empty\n" {
+		t.Fatalf("find after load: %q", stdout)
+	}
+	stdout, _, _ = run(t, dst.URI(), "", "get", "/x/bin")
+	if stdout != string(body) {
+		t.Fatalf("get after load: %d bytes, want %d", len(stdout), len(body))
+	}
+
+	_, _, code = run(t, dst.URI(), dump[:len(dump)-1], "load", "/t")
+	if code != exitFailure {
+		t.Fatalf("load of a cut dump: exit %d, want %d", code, exitFailure)
+	}
+}
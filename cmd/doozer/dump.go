@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bufio"
+	"os"
+)
+
+func init() {
+	cmds["dump"] = cmd{dump, "<glob>", "write files to stdout"}
+	cmdHelp["dump"] = `Writes every file matching <glob> to stdout, in a form
+that can be read by load.
+
+Rules for <glob> pattern-matching:
+ - '?' matches a single char in a single path component
+ - '*' matches zero or more chars in a single path component
+ - '**' matches zero or more chars in zero or more components
+ - any other sequence matches itself
+`
+}
+
+func dump(glob string) {
+	c := dial()
+
+	w := bufio.NewWriter(os.Stdout)
+	err := c.DumpTo(w, glob)
+	if err != nil {
+		bail(err)
+	}
+
+	err = w.Flush()
+	if err != nil {
+		bail(err)
+	}
+}
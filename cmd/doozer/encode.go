@@ -0,0 +1,24 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+)
+
+// encodeBody returns body encoded as flag -e asks,
+// or body itself if -e is not given.
+func encodeBody(body []byte) []byte {
+	switch *encoding {
+	case "":
+		return body
+	case "hex":
+		return []byte(hex.EncodeToString(body))
+	case "base64":
+		return []byte(base64.StdEncoding.EncodeToString(body))
+	}
+	fmt.Fprintf(os.Stderr, "%s: unknown encoding %q\n", selfName, *encoding)
+	os.Exit(exitUsage)
+	panic("unreachable")
+}
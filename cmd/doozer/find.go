@@ -11,6 +11,14 @@ func init() {
 	cmdHelp["find"] = `Prints the tree rooted at <path>
 
 Prints the path for each file or directory, one per line.
+
+If flag -json is given, prints a JSON object for each instead:
+
+  {"rev":<rev>,"path":<path>,"flag":"set","dir":true}
+
+where "dir" is omitted for files. The first error stops the walk,
+and is printed as a last line of the form {"error":<message>},
+with nothing written to stderr.
 `
 }
 
@@ -34,24 +42,31 @@ func find(path string) {
 
 	for {
 		select {
-		case path, ok := <-v:
+		case r, ok := <-v:
 			if !ok {
 				return
 			}
-			fmt.Println(path)
+			if *asJSON {
+				writeJSON(r)
+				continue
+			}
+			fmt.Println(r.Path)
 		case err := <-errs:
+			if *asJSON {
+				bail(err)
+			}
 			fmt.Fprintln(os.Stderr, err)
 		}
 	}
 }
 
-type vis chan string
+type vis chan jsonRecord
 
 func (v vis) VisitDir(path string, f *doozer.FileInfo) bool {
-	v <- path
+	v <- jsonRecord{Rev: f.Rev, Path: path, Flag: "set", IsDir: true}
 	return true
 }
 
 func (v vis) VisitFile(path string, f *doozer.FileInfo) {
-	v <- path
+	v <- jsonRecord{Rev: f.Rev, Path: path, Flag: "set"}
 }
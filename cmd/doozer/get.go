@@ -1,21 +1,39 @@
 package main
 
 import (
+	"fmt"
 	"os"
 )
 
 func init() {
 	cmds["get"] = cmd{get, "<path>", "read a file"}
-	cmdHelp["get"] = "Prints the body of the file at <path>.\n"
+	cmdHelp["get"] = `Prints the body of the file at <path>, and its revision
+on stderr.
+
+If flag -r is given, prints the body as of <rev>.
+
+The body is written exactly as stored, with no newline added.
+If there is no such file, prints nothing and exits with status 1.
+If flag -e is given, it is instead printed encoded as hex or
+base64, followed by a newline.
+`
 }
 
 func get(path string) {
 	c := dial()
 
-	body, _, err := c.Get(path, nil)
+	body, rev, err := c.Get(path, reqRev())
 	if err != nil {
 		bail(err)
 	}
+	if rev == 0 {
+		fmt.Fprintln(os.Stderr, "No such file:", path)
+		os.Exit(exitNoEnt)
+	}
 
+	if *encoding != "" {
+		body = append(encodeBody(body), '\n')
+	}
 	os.Stdout.Write(body)
+	fmt.Fprintln(os.Stderr, rev)
 }
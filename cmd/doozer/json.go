@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// A jsonRecord is one line of find's output under flag -json.
+type jsonRecord struct {
+	Rev   int64  `json:"rev"`
+	Path  string `json:"path"`
+	Flag  string `json:"flag"`
+	IsDir bool   `json:"dir,omitempty"`
+}
+
+// A jsonEvent is one line of watch's output under flag -json.
+// Body is always present, and is "" for an empty body or a delete.
+type jsonEvent struct {
+	Rev  int64  `json:"rev"`
+	Path string `json:"path"`
+	Flag string `json:"flag"`
+	Body string `json:"body_b64"` // encoded as base64
+}
+
+// A jsonError is the last line of output under flag -json,
+// when a command fails.
+type jsonError struct {
+	Error string `json:"error"`
+}
+
+// writeJSON prints v as a single line. Stdout is unbuffered,
+// so a consumer sees each line as soon as it is written.
+func writeJSON(v interface{}) {
+	err := json.NewEncoder(os.Stdout).Encode(v)
+	if err != nil {
+		bail(err)
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"os"
+)
+
+var prune = flag.Bool("x", false, "delete files not in the dump")
+
+func init() {
+	cmds["load"] = cmd{load, "<prefix>", "read files from stdin"}
+	cmdHelp["load"] = `Reads files written by dump from stdin, and sets each one
+at <prefix> followed by its dumped path. Existing files are overwritten.
+
+If flag -x is given, deletes every file under <prefix> that
+was not in the dump.
+
+Use a <prefix> of "" to load files at their original paths.
+`
+}
+
+func load(prefix string) {
+	c := dial()
+
+	err := c.LoadFrom(bufio.NewReader(os.Stdin), prefix, *prune)
+	if err != nil {
+		bail(err)
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+)
+
+func init() {
+	cmds["ls"] = cmd{ls, "<path>", "list a directory"}
+	cmdHelp["ls"] = `Prints the names in the directory at <path>, one per line.
+
+If flag -r is given, lists the directory as of <rev>.
+`
+}
+
+func ls(path string) {
+	c := dial()
+
+	if *rrev == -1 {
+		var err error
+		*rrev, err = c.Rev()
+		if err != nil {
+			bail(err)
+		}
+	}
+
+	names, err := c.Getdir(path, *rrev, 0, -1)
+	if err != nil {
+		bail(err)
+	}
+
+	for _, name := range names {
+		fmt.Println(name)
+	}
+}
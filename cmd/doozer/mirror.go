@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/ha/doozer"
+	"os"
+	"os/signal"
+)
+
+var skip = flag.Bool("s", false, "leave files changed in the mirror alone")
+
+func init() {
+	cmds["mirror"] = cmd{mirror, "<glob> <uri> <prefix>", "copy files to another cluster"}
+	cmdHelp["mirror"] = `Copies every file matching <glob> to the doozer cluster at <uri>,
+under <prefix>, then keeps the copy up to date until interrupted.
+
+When it stops, prints the last mirrored revision on stderr.
+If flag -r is given, skips the initial copy and applies changes
+made after <rev>; use this to resume from a previous run.
+
+A file changed in the mirror since it was last copied is
+overwritten, unless flag -s is given.
+`
+}
+
+func mirror(glob, dst, prefix string) {
+	src := dial()
+
+	d, err := doozer.DialUri(dst, *buri)
+	if err != nil {
+		bail(err)
+	}
+
+	m := &doozer.Mirror{Src: src, Dst: d, Glob: glob, Prefix: prefix}
+	if *rrev != -1 {
+		m.From = *rrev
+	}
+	if *skip {
+		m.Policy = doozer.Skip
+	}
+
+	errc := make(chan error, 1)
+	go func() { errc <- m.Run() }()
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+
+	select {
+	case err = <-errc:
+		fmt.Fprintln(os.Stderr, "mirrored through rev", m.Rev())
+		bail(err)
+	case <-sig:
+		fmt.Fprintln(os.Stderr, "mirrored through rev", m.Rev())
+	}
+}
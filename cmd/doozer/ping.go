@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+func init() {
+	cmds["ping"] = cmd{ping, "", "measure latency to each node"}
+	cmdHelp["ping"] = `Sends a nop to each node in the cluster, on a new connection
+to each, and prints each node's address and round trip time.
+An unreachable node is printed with the error instead.
+`
+}
+
+func ping() {
+	c := dial()
+
+	rs, err := c.Ping(5 * time.Second)
+	if err != nil {
+		bail(err)
+	}
+
+	for _, r := range rs {
+		if r.Err != nil {
+			fmt.Println(r.Addr, "error:", r.Err)
+		} else {
+			fmt.Println(r.Addr, r.RTT)
+		}
+	}
+}
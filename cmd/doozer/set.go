@@ -10,8 +10,9 @@ func init() {
 	cmds["set"] = cmd{set, "<path> <rev>", "write a file"}
 	cmdHelp["set"] = `Sets the body of the file at <path>.
 
-The body is read from stdin. If <rev> is not greater than or equal to
-the revision of the file, no change will be made.
+The body is read from stdin, byte for byte, up to EOF.
+If <rev> is not greater than or equal to the revision of the file,
+no change will be made.
 
 Prints the new revision on stdout, or an error message on stderr.
 `
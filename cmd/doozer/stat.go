@@ -11,13 +11,15 @@ func init() {
 
 If path is a directory, prints "d" and the number of entries.
 Otherwise, prints its revision and length.
+
+If flag -r is given, prints the status as of <rev>.
 `
 }
 
 func stat(path string) {
 	c := dial()
 
-	len, rev, err := c.Stat(path, nil)
+	len, rev, err := c.Stat(path, reqRev())
 	if err != nil {
 		bail(err)
 	}
@@ -25,7 +27,7 @@ func stat(path string) {
 	switch rev {
 	case 0:
 		fmt.Fprintln(os.Stderr, "No such file or directory:", path)
-		os.Exit(2)
+		os.Exit(exitNoEnt)
 	case -2:
 		fmt.Println("d", len)
 	default:
@@ -9,7 +9,6 @@ import (
 var timeout = flag.Duration("t", 0, "wait timeout")
 
 func init() {
-	flag.Parse()
 	cmds["wait"] = cmd{wait, "<glob>", "wait for a change"}
 	cmdHelp["wait"] = `Prints the next change to a file matching <glob>.
 
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/base64"
 	"fmt"
 	"os"
 )
@@ -23,6 +24,19 @@ Output is a sequence of records, one for each change. Format of each record:
 
 Here, <path> is the file's path, <rev> is the revision of the change,
 <len> is the number of bytes in the body, and LF is an ASCII line-feed char.
+
+If flag -0 is given, each LF is a NUL char instead, so records can be
+split safely by tools such as xargs -0. If flag -e is given, the body
+is encoded as hex or base64, and <len> is the length of the encoding.
+
+If flag -json is given, each record is instead a JSON object on one line:
+
+  {"rev":<rev>,"path":<path>,"flag":"set"|"del","body_b64":<body>}
+
+where <body> is base64-encoded, and is "" for an empty body or a delete.
+Flags -0 and -e have no effect on JSON records.
+If the watch fails, the last line is an object of the form
+{"error":<message>}, and nothing is written to stderr.
 `
 }
 
@@ -37,6 +51,11 @@ func watch(glob string) {
 		}
 	}
 
+	sep := "\n"
+	if *nulSep {
+		sep = "\x00"
+	}
+
 	for {
 		ev, err := c.Wait(glob, *rrev)
 		if err != nil {
@@ -51,8 +70,19 @@ func watch(glob string) {
 		case ev.IsDel():
 			sd = "del"
 		}
-		fmt.Println(ev.Path, ev.Rev, sd, len(ev.Body))
-		os.Stdout.Write(ev.Body)
-		fmt.Println()
+		if *asJSON {
+			writeJSON(jsonEvent{
+				Rev:  ev.Rev,
+				Path: ev.Path,
+				Flag: sd,
+				Body: base64.StdEncoding.EncodeToString(ev.Body),
+			})
+			continue
+		}
+
+		body := encodeBody(ev.Body)
+		fmt.Print(ev.Path, " ", ev.Rev, " ", sd, " ", len(body), sep)
+		os.Stdout.Write(body)
+		fmt.Print(sep)
 	}
 }
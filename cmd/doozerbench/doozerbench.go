@@ -0,0 +1,322 @@
+// Command doozerbench measures package doozer against the in-memory
+// server from package doozertest.
+//
+// It runs one mix of operations for a fixed time and reports
+// throughput, latency percentiles, allocations per operation, and
+// the most goroutines seen. The mixes are:
+//
+//	read   9 gets for each set
+//	write  9 sets for each get
+//	watch  -watchers watches of one tree, fed by -writers writers;
+//	       latency is from each set to its arrival at a watcher
+//
+// With -pool n, the workers share a Pool of n connections, each
+// request going to the least loaded one.
+//
+// With -json, the results are printed as a JSON object, for tracking
+// regressions.
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/ha/doozer"
+	"github.com/ha/doozer/doozertest"
+	"math/rand"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	mix      = flag.String("mix", "read", "operation mix: read, write, or watch")
+	dur      = flag.Duration("t", 5*time.Second, "how long to run")
+	workers  = flag.Int("c", 8, "concurrent workers, for read and write")
+	watchers = flag.Int("watchers", 8, "watchers, for watch")
+	writers  = flag.Int("writers", 2, "writers, for watch")
+	keys     = flag.Int("keys", 100, "distinct files to use")
+	size     = flag.Int("size", 64, "body size in bytes")
+	pool     = flag.Int("pool", 1, "connections in the Pool the workers share")
+	inflight = flag.Int("inflight", 0, "Conn.MaxInFlight for each connection")
+	asJSON   = flag.Bool("json", false, "print results as JSON")
+)
+
+// A result is the outcome of one run.
+type result struct {
+	Mix         string  `json:"mix"`
+	Pool        int     `json:"pool"`
+	MaxInFlight int     `json:"inflight"`
+	Seconds     float64 `json:"seconds"`
+	Ops         int64   `json:"ops"`
+	Errors      int64   `json:"errors"`
+	OpsPerSec   float64 `json:"ops_per_sec"`
+	P50         int64   `json:"p50_us"`
+	P90         int64   `json:"p90_us"`
+	P99         int64   `json:"p99_us"`
+	Max         int64   `json:"max_us"`
+	AllocsPerOp float64 `json:"allocs_per_op"`
+	BytesPerOp  float64 `json:"bytes_per_op"`
+	Goroutines  int     `json:"max_goroutines"`
+}
+
+// A recorder collects the latencies seen by one goroutine.
+type recorder struct {
+	lat  []time.Duration
+	errs int64
+}
+
+func main() {
+	flag.Parse()
+
+	s, err := doozertest.NewServer()
+	if err != nil {
+		bail(err)
+	}
+	defer s.Close()
+
+	p, err := doozer.DialPool(s.Addr, *pool)
+	if err != nil {
+		bail(err)
+	}
+	defer p.Close()
+	for _, c := range p.Conns() {
+		c.MaxInFlight = *inflight
+	}
+
+	body := make([]byte, *size)
+	for i := 0; i < *keys; i++ {
+		_, err = p.Conn().Set(key(i), -1, body)
+		if err != nil {
+			bail(err)
+		}
+	}
+
+	var run func(*doozer.Pool, <-chan bool) []*recorder
+	switch *mix {
+	case "read":
+		run = func(p *doozer.Pool, stop <-chan bool) []*recorder {
+			return ops(p, stop, *workers, 0.9)
+		}
+	case "write":
+		run = func(p *doozer.Pool, stop <-chan bool) []*recorder {
+			return ops(p, stop, *workers, 0.1)
+		}
+	case "watch":
+		run = watch
+	default:
+		fmt.Fprintln(os.Stderr, "doozerbench: unknown mix:", *mix)
+		os.Exit(2)
+	}
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	stop := make(chan bool)
+	maxg := make(chan int)
+	go sampleGoroutines(stop, maxg)
+	time.AfterFunc(*dur, func() { close(stop) })
+
+	start := time.Now()
+	recs := run(p, stop)
+	secs := time.Since(start).Seconds()
+
+	runtime.ReadMemStats(&after)
+
+	r := summarize(recs)
+	r.Mix = *mix
+	r.Pool = *pool
+	r.MaxInFlight = *inflight
+	r.Seconds = secs
+	r.OpsPerSec = float64(r.Ops) / secs
+	r.Goroutines = <-maxg
+	if r.Ops > 0 {
+		r.AllocsPerOp = float64(after.Mallocs-before.Mallocs) / float64(r.Ops)
+		r.BytesPerOp = float64(after.TotalAlloc-before.TotalAlloc) / float64(r.Ops)
+	}
+
+	if *asJSON {
+		json.NewEncoder(os.Stdout).Encode(r)
+		return
+	}
+	fmt.Printf("%s: %d ops in %.2fs, %.0f ops/s, %d errors\n",
+		r.Mix, r.Ops, r.Seconds, r.OpsPerSec, r.Errors)
+	fmt.Printf("latency: p50 %dµs p90 %dµs p99 %dµs max %dµs\n",
+		r.P50, r.P90, r.P99, r.Max)
+	fmt.Printf("%.1f allocs/op, %.0f B/op, %d goroutines at most\n",
+		r.AllocsPerOp, r.BytesPerOp, r.Goroutines)
+}
+
+// ops runs n workers until stop is closed, each reading with
+// probability reads, and writing otherwise. Each operation goes
+// to the least loaded connection in p.
+func ops(p *doozer.Pool, stop <-chan bool, n int, reads float64) []*recorder {
+	recs := make([]*recorder, n)
+	var wg sync.WaitGroup
+	for i := range recs {
+		recs[i] = new(recorder)
+		wg.Add(1)
+		go func(rec *recorder, seed int64) {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(seed))
+			body := make([]byte, *size)
+			for !stopped(stop) {
+				k := key(rnd.Intn(*keys))
+				t0 := time.Now()
+				var err error
+				if rnd.Float64() < reads {
+					_, _, err = p.Conn().Get(k, nil)
+				} else {
+					_, err = p.Conn().Set(k, -1, body)
+				}
+				rec.add(time.Since(t0), err)
+			}
+		}(recs[i], int64(i))
+	}
+	wg.Wait()
+	return recs
+}
+
+// watch runs the watch mix until stop is closed. Each body written
+// holds the time it was sent, so watchers can tell how long it took
+// to arrive. Only arrivals count as ops. Each watch stays on the
+// connection it started on.
+func watch(p *doozer.Pool, stop <-chan bool) []*recorder {
+	rev, err := p.Conn().Rev()
+	if err != nil {
+		bail(err)
+	}
+
+	// Spread the watches over p's connections by hand; none
+	// is in flight yet for Pool.Conn to balance by.
+	cs := p.Conns()
+	recs := make([]*recorder, *watchers)
+	var wg sync.WaitGroup
+	var ws []*doozer.Watch
+	for i := range recs {
+		recs[i] = new(recorder)
+		w := cs[i%len(cs)].Watch("/bench/**", rev+1)
+		ws = append(ws, w)
+		wg.Add(1)
+		go func(rec *recorder) {
+			defer wg.Done()
+			for {
+				ev, err := w.Next()
+				if err != nil {
+					return
+				}
+				if len(ev.Body) >= 8 {
+					sent := int64(binary.BigEndian.Uint64(ev.Body))
+					rec.add(time.Duration(time.Now().UnixNano()-sent), nil)
+				}
+			}
+		}(recs[i])
+	}
+
+	var werrs int64
+	var wwg sync.WaitGroup
+	for i := 0; i < *writers; i++ {
+		wwg.Add(1)
+		go func(seed int64) {
+			defer wwg.Done()
+			rnd := rand.New(rand.NewSource(seed))
+			body := make([]byte, *size+8)
+			for !stopped(stop) {
+				binary.BigEndian.PutUint64(body, uint64(time.Now().UnixNano()))
+				_, err := p.Conn().Set(key(rnd.Intn(*keys)), -1, body)
+				if err != nil {
+					atomic.AddInt64(&werrs, 1)
+				}
+			}
+		}(int64(i))
+	}
+	wwg.Wait()
+
+	// Give the watchers a moment to drain what was written.
+	time.Sleep(100 * time.Millisecond)
+	for _, w := range ws {
+		w.Cancel()
+	}
+	wg.Wait()
+	return append(recs, &recorder{errs: werrs})
+}
+
+func (r *recorder) add(d time.Duration, err error) {
+	if err != nil {
+		r.errs++
+		return
+	}
+	r.lat = append(r.lat, d)
+}
+
+func summarize(recs []*recorder) result {
+	var r result
+	var lat []time.Duration
+	for _, rec := range recs {
+		lat = append(lat, rec.lat...)
+		r.Errors += rec.errs
+	}
+	r.Ops = int64(len(lat))
+	if len(lat) == 0 {
+		return r
+	}
+
+	sort.Sort(durations(lat))
+	pct := func(p float64) int64 {
+		return int64(lat[int(p*float64(len(lat)-1))] / time.Microsecond)
+	}
+	r.P50 = pct(0.50)
+	r.P90 = pct(0.90)
+	r.P99 = pct(0.99)
+	r.Max = pct(1)
+	return r
+}
+
+// sampleGoroutines sends the most goroutines seen on max,
+// after stop is closed.
+func sampleGoroutines(stop <-chan bool, max chan<- int) {
+	n := runtime.NumGoroutine()
+	t := time.NewTicker(10 * time.Millisecond)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if g := runtime.NumGoroutine(); g > n {
+				n = g
+			}
+		case <-stop:
+			max <- n
+			return
+		}
+	}
+}
+
+func stopped(stop <-chan bool) bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func key(i int) string {
+	return "/bench/" + strconv.Itoa(i)
+}
+
+func bail(err error) {
+	fmt.Fprintln(os.Stderr, "doozerbench:", err)
+	os.Exit(1)
+}
+
+type durations []time.Duration
+
+func (d durations) Len() int           { return len(d) }
+func (d durations) Less(i, j int) bool { return d[i] < d[j] }
+func (d durations) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
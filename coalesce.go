@@ -0,0 +1,85 @@
+package doozer
+
+import (
+	"container/list"
+	"io"
+	"sync"
+)
+
+// A Coalescer reads a Watch in the background and keeps only the
+// latest event for each path, so a slow reader sees the current
+// state of each file rather than every change to it. Events come
+// out in order of their revisions, but a file changed several
+// times yields one event, with Collapsed counting the others.
+type Coalescer struct {
+	w *Watch
+
+	mu        sync.Mutex
+	cond      sync.Cond
+	pending   list.List // of *Event, oldest first
+	byPath    map[string]*list.Element
+	err       error
+	cancelled bool
+}
+
+// Coalesce returns a Coalescer reading w. The caller must not
+// call w.Next itself after this.
+func (w *Watch) Coalesce() *Coalescer {
+	co := &Coalescer{
+		w:      w,
+		byPath: make(map[string]*list.Element),
+	}
+	co.cond.L = &co.mu
+	go co.run()
+	return co
+}
+
+func (co *Coalescer) run() {
+	for {
+		ev, err := co.w.Next()
+		co.mu.Lock()
+		if err != nil {
+			co.err = err
+			co.cond.Broadcast()
+			co.mu.Unlock()
+			return
+		}
+		if e, ok := co.byPath[ev.Path]; ok {
+			ev.Collapsed = e.Value.(*Event).Collapsed + 1
+			co.pending.Remove(e)
+		}
+		co.byPath[ev.Path] = co.pending.PushBack(ev)
+		co.cond.Broadcast()
+		co.mu.Unlock()
+	}
+}
+
+// Next returns the oldest pending event, waiting for one if need be.
+// After Cancel, Next returns io.EOF. If the watch fails, Next
+// returns the events still pending, then the error.
+func (co *Coalescer) Next() (*Event, error) {
+	co.mu.Lock()
+	defer co.mu.Unlock()
+	for co.pending.Len() == 0 && co.err == nil && !co.cancelled {
+		co.cond.Wait()
+	}
+	if co.cancelled {
+		return nil, io.EOF
+	}
+	if co.pending.Len() == 0 {
+		return nil, co.err
+	}
+
+	ev := co.pending.Remove(co.pending.Front()).(*Event)
+	delete(co.byPath, ev.Path)
+	return ev, nil
+}
+
+// Cancel stops co and its Watch.
+func (co *Coalescer) Cancel() {
+	co.w.Cancel()
+	co.mu.Lock()
+	co.cancelled = true
+	co.cond.Broadcast()
+	co.mu.Unlock()
+}
@@ -0,0 +1,116 @@
+package doozer
+
+import (
+	"io"
+	"testing"
+)
+
+// coalesceWrites makes a run of changes under /co and returns the
+// revision before the first and the revision of the last.
+func coalesceWrites(t *testing.T, c *Conn) (from, last int64) {
+	from, err := c.Rev()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, w := range []struct{ path, body string }{
+		{"/co/a", "1"},
+		{"/co/a", "2"},
+		{"/co/b", "x"},
+		{"/co/a", "3"},
+	} {
+		if _, err := c.Set(w.path, clobber, []byte(w.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Del("/co/a", clobber); err != nil {
+		t.Fatal(err)
+	}
+	last, err = c.Set("/co/c", clobber, []byte("y"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return from, last
+}
+
+func TestCoalesce(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+	from, last := coalesceWrites(t, c)
+
+	co := c.Watch("/co/*", from+1).Coalesce()
+	defer co.Cancel()
+	caught := settle(func() bool {
+		co.mu.Lock()
+		defer co.mu.Unlock()
+		e := co.pending.Back()
+		return e != nil && e.Value.(*Event).Rev == last
+	})
+	if !caught {
+		t.Fatal("Coalescer never read the last change")
+	}
+
+	// The Del of /co/a replaces its three Sets, and comes out
+	// in its own place, after /co/b.
+	want := []struct {
+		path, body string
+		del        bool
+		collapsed  int
+	}{
+		{"/co/b", "x", false, 0},
+		{"/co/a", "", true, 3},
+		{"/co/c", "y", false, 0},
+	}
+	for _, w := range want {
+		ev, err := co.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ev.Path != w.path || string(ev.Body) != w.body || ev.IsDel() != w.del || ev.Collapsed != w.collapsed {
+			t.Fatalf("Next: %v collapsed %d, want %s %q del %v collapsed %d",
+				ev, ev.Collapsed, w.path, w.body, w.del, w.collapsed)
+		}
+	}
+
+	// A later change to a path already handed out starts afresh.
+	rev, err := c.Set("/co/b", clobber, []byte("z"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev, err := co.Next()
+	if err != nil || ev.Rev != rev || ev.Collapsed != 0 {
+		t.Fatalf("Next after draining: %v %v", ev, err)
+	}
+
+	co.Cancel()
+	if ev, err := co.Next(); err != io.EOF {
+		t.Fatalf("Next after Cancel: %v %v, want io.EOF", ev, err)
+	}
+}
+
+// TestWatchNotCoalesced checks that coalescing is opt-in: a plain
+// Watch still yields every change.
+func TestWatchNotCoalesced(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+	from, last := coalesceWrites(t, c)
+
+	w := c.Watch("/co/*", from+1)
+	defer w.Cancel()
+	var n int
+	for {
+		ev, err := w.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ev.Collapsed != 0 {
+			t.Fatalf("plain Watch event %v has Collapsed %d", ev, ev.Collapsed)
+		}
+		n++
+		if ev.Rev == last {
+			break
+		}
+	}
+	if n != 6 {
+		t.Fatalf("plain Watch yielded %d events, want 6", n)
+	}
+}
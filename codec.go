@@ -0,0 +1,112 @@
+package doozer
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"reflect"
+)
+
+// A Codec converts between values and file bodies.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// Codecs for GetAs, SetAs, and UpdateAs.
+var (
+	JSON Codec = jsonCodec{}
+	Gob  Codec = gobCodec{}
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type gobCodec struct{}
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	err := gob.NewEncoder(&b).Encode(v)
+	if err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// A CodecError is returned when a value can't be encoded, or a
+// body decoded, such as when a file holds a value of another type.
+// It is never temporary, and never a conflict.
+type CodecError struct {
+	Path string
+	Err  error
+}
+
+func (e *CodecError) Error() string {
+	return e.Path + ": " + e.Err.Error()
+}
+
+// GetAs reads file at revision *rev, or the current revision if rev
+// is nil, and decodes its body into v with codec. It returns the
+// file's revision. If there is no such file, it returns 0 and
+// leaves v alone. Bodies are decompressed before decoding.
+func (c *Conn) GetAs(file string, rev *int64, codec Codec, v interface{}) (int64, error) {
+	body, frev, err := c.Get(file, rev)
+	if err != nil || frev == 0 {
+		return frev, err
+	}
+
+	err = codec.Unmarshal(body, v)
+	if err != nil {
+		return 0, &CodecError{file, err}
+	}
+	return frev, nil
+}
+
+// SetAs encodes v with codec and sets file to the result, as Set
+// does, compressing it if c.Compress is set.
+func (c *Conn) SetAs(file string, oldRev int64, codec Codec, v interface{}) (int64, error) {
+	body, err := codec.Marshal(v)
+	if err != nil {
+		return 0, &CodecError{file, err}
+	}
+	return c.Set(file, oldRev, body)
+}
+
+// UpdateAs reads file into v, which must be a pointer, calls fn to
+// change v, and writes v back, provided the file has not changed
+// in between. If it has, UpdateAs tries again with the new value,
+// so fn may be called more than once; v is zeroed before each read.
+// If there is no such file, fn sees the zero value, and the file is
+// created. If fn returns an error, UpdateAs returns it and writes
+// nothing. Otherwise, UpdateAs returns the file's new revision.
+func (c *Conn) UpdateAs(file string, codec Codec, v interface{}, fn func() error) (int64, error) {
+	pv := reflect.ValueOf(v).Elem()
+	for {
+		pv.Set(reflect.Zero(pv.Type()))
+		rev, err := c.GetAs(file, nil, codec, v)
+		if err != nil {
+			return 0, err
+		}
+
+		err = fn()
+		if err != nil {
+			return 0, err
+		}
+
+		newRev, err := c.SetAs(file, rev, codec, v)
+		if !IsConflict(err) {
+			return newRev, err
+		}
+	}
+}
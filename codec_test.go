@@ -0,0 +1,178 @@
+package doozer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+type codecConfig struct {
+	Host  string
+	Port  int
+	Peers []string
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+	plain := dialServer(t, s)
+
+	// Enough peers for the body to pass CompressMin.
+	want := codecConfig{Host: "db1", Port: 5432}
+	for i := 0; i < 200; i++ {
+		want.Peers = append(want.Peers, "db2", "db3")
+	}
+	for _, tt := range []struct {
+		name     string
+		codec    Codec
+		compress bool
+	}{
+		{"json", JSON, false},
+		{"gob", Gob, false},
+		{"json-gz", JSON, true},
+		{"gob-gz", Gob, true},
+	} {
+		c.Compress = tt.compress
+		path := "/codec/" + tt.name
+		rev, err := c.SetAs(path, clobber, tt.codec, want)
+		if err != nil {
+			t.Fatalf("%s: SetAs: %v", tt.name, err)
+		}
+		var got codecConfig
+		frev, err := c.GetAs(path, nil, tt.codec, &got)
+		if err != nil || frev != rev || !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: GetAs: %+v %d %v, want %+v %d", tt.name, got, frev, err, want, rev)
+		}
+
+		// The codec's output is what gets compressed.
+		body, _, err := plain.Get(path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.HasPrefix(body, gzipMagic) != tt.compress {
+			t.Fatalf("%s: stored body %q", tt.name, body)
+		}
+		if body, err = c.decode(body); err != nil {
+			t.Fatal(err)
+		}
+		enc, _ := tt.codec.Marshal(want)
+		if !bytes.Equal(body, enc) {
+			t.Fatalf("%s: decompressed body %q, want %q", tt.name, body, enc)
+		}
+	}
+
+	// A missing file leaves v alone.
+	got := codecConfig{Host: "keep"}
+	rev, err := c.GetAs("/codec/none", nil, JSON, &got)
+	if err != nil || rev != 0 || got.Host != "keep" {
+		t.Fatalf("GetAs of a missing file: %+v %d %v", got, rev, err)
+	}
+}
+
+// TestCodecErrors checks that encoding and decoding failures come
+// back as a CodecError, which is told apart from a transport error.
+func TestCodecErrors(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+
+	if _, err := c.SetAs("/codec/cfg", clobber, JSON, codecConfig{Port: 1}); err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	var cfg codecConfig
+	for _, tt := range []struct {
+		name  string
+		codec Codec
+		v     interface{}
+	}{
+		{"json into an int", JSON, &n},
+		{"gob of json", Gob, &cfg},
+	} {
+		_, err := c.GetAs("/codec/cfg", nil, tt.codec, tt.v)
+		ce, ok := err.(*CodecError)
+		if !ok || ce.Path != "/codec/cfg" || IsTemporary(err) || IsConflict(err) {
+			t.Fatalf("GetAs %s: %#v, want a permanent CodecError", tt.name, err)
+		}
+	}
+
+	_, err := c.SetAs("/codec/ch", clobber, JSON, make(chan int))
+	if _, ok := err.(*CodecError); !ok {
+		t.Fatalf("SetAs of a chan: %#v, want a CodecError", err)
+	}
+	if ok, _, err := c.Exists("/codec/ch", nil); err != nil || ok {
+		t.Fatalf("SetAs wrote a value it couldn't encode: %v %v", ok, err)
+	}
+
+	s.DropConns()
+	_, err = c.GetAs("/codec/cfg", nil, JSON, &cfg)
+	if _, ok := err.(*CodecError); ok || err == nil {
+		t.Fatalf("GetAs on a dropped connection: %#v, want a transport error", err)
+	}
+}
+
+func TestUpdateAs(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+	other := dialServer(t, s)
+
+	type counter struct{ N int }
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(c *Conn) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				var v counter
+				_, err := c.UpdateAs("/codec/n", JSON, &v, func() error {
+					v.N++
+					return nil
+				})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}([]*Conn{c, other}[i%2])
+	}
+	wg.Wait()
+
+	var v counter
+	rev, err := c.GetAs("/codec/n", nil, JSON, &v)
+	if err != nil || v.N != 100 {
+		t.Fatalf("counter after 100 updates: %d %v", v.N, err)
+	}
+
+	// An error from fn stops UpdateAs before it writes.
+	stop := errors.New("stop")
+	_, err = c.UpdateAs("/codec/n", JSON, &v, func() error {
+		v.N = -1
+		return stop
+	})
+	if err != stop {
+		t.Fatalf("UpdateAs: %v, want fn's error", err)
+	}
+	if frev, _ := c.GetAs("/codec/n", nil, JSON, &v); frev != rev || v.N != 100 {
+		t.Fatalf("UpdateAs wrote after fn failed: %d at %d", v.N, frev)
+	}
+
+	// A body of another type fails the update without writing.
+	if _, err := c.Set("/codec/bad", clobber, []byte(`"text"`)); err != nil {
+		t.Fatal(err)
+	}
+	calls := 0
+	_, err = c.UpdateAs("/codec/bad", JSON, &v, func() error {
+		calls++
+		return nil
+	})
+	if _, ok := err.(*CodecError); !ok || calls != 0 {
+		t.Fatalf("UpdateAs of a mismatched body: %#v, fn called %d times", err, calls)
+	}
+	body, _, _ := c.Get("/codec/bad", nil)
+	var s2 string
+	if json.Unmarshal(body, &s2) != nil || s2 != "text" {
+		t.Fatalf("mismatched body changed to %q", body)
+	}
+}
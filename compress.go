@@ -0,0 +1,62 @@
+package doozer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+)
+
+// defaultCompressMin is the default value of Conn.CompressMin.
+const defaultCompressMin = 1024
+
+// A compressed body is stored as the six bytes of gzipMagic,
+// "\x00dzgz\x01", followed by a gzip stream (RFC 1952) of the
+// original body. Any other body is stored as is. Clients in other
+// languages can interoperate by checking for this prefix.
+var gzipMagic = []byte("\x00dzgz\x01")
+
+// encode returns body as it should be stored.
+// A nil body is stored as empty, like any other empty body.
+func (c *Conn) encode(body []byte) []byte {
+	body = nonNil(body)
+	min := c.CompressMin
+	if min <= 0 {
+		min = defaultCompressMin
+	}
+	if !c.Compress || len(body) < min {
+		return body
+	}
+
+	var b bytes.Buffer
+	b.Write(gzipMagic)
+	w := gzip.NewWriter(&b)
+	w.Write(body)
+	w.Close()
+	if b.Len() >= len(body) {
+		return body
+	}
+	return b.Bytes()
+}
+
+// decode returns the original body of a stored one.
+func (c *Conn) decode(body []byte) ([]byte, error) {
+	if !c.Compress || !bytes.HasPrefix(body, gzipMagic) {
+		return body, nil
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(body[len(gzipMagic):]))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// nonNil returns body, or an empty slice if body is nil,
+// so that an empty file always reads as a non-nil empty body.
+func nonNil(body []byte) []byte {
+	if body == nil {
+		return []byte{}
+	}
+	return body
+}
@@ -0,0 +1,100 @@
+package doozer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// config is a body that compresses well.
+var config = []byte(strings.Repeat(`{"host": "db1", "port": 5432}`+"\n", 100))
+
+func TestCompressRoundTrip(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+
+	c.Compress = true
+	rev, err := c.Set("/z", clobber, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, frev, err := c.Get("/z", nil)
+	if err != nil || !bytes.Equal(body, config) || frev != rev {
+		t.Fatalf("Get with Compress: %d bytes, rev %d, %v", len(body), frev, err)
+	}
+
+	ev, err := c.Wait("/z", rev)
+	if err != nil || !bytes.Equal(ev.Body, config) {
+		t.Fatalf("Wait with Compress: %d bytes, %v", len(ev.Body), err)
+	}
+
+	// Once Compress is off, the stored bytes are returned as they are.
+	c.Compress = false
+	body, _, err = c.Get("/z", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(body, gzipMagic) || len(body) >= len(config) {
+		t.Fatalf("stored body: %d bytes, %q...", len(body), body[:10])
+	}
+}
+
+func TestCompressSmallBody(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+	plain := dialServer(t, s)
+
+	c.Compress = true
+	if _, err := c.Set("/small", clobber, config[:300]); err != nil {
+		t.Fatal(err)
+	}
+	body, _, err := plain.Get("/small", nil)
+	if err != nil || !bytes.Equal(body, config[:300]) {
+		t.Fatalf("body under CompressMin: %q %v", body, err)
+	}
+
+	c.CompressMin = 10
+	if _, err := c.Set("/small", clobber, config[:300]); err != nil {
+		t.Fatal(err)
+	}
+	body, _, err = plain.Get("/small", nil)
+	if err != nil || !bytes.HasPrefix(body, gzipMagic) {
+		t.Fatalf("body over a lower CompressMin: %q %v", body, err)
+	}
+}
+
+// TestCompressMixedReaders checks that compressing and plain clients
+// can share a store.
+func TestCompressMixedReaders(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+	plain := dialServer(t, s)
+	c.Compress = true
+
+	// A plain value written by another client reads as it is.
+	rev, err := plain.Set("/plain", clobber, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, frev, err := c.Get("/plain", nil)
+	if err != nil || !bytes.Equal(body, config) || frev != rev {
+		t.Fatalf("plain value read with Compress: %d bytes, %v", len(body), err)
+	}
+	ev, err := c.Wait("/plain", rev)
+	if err != nil || !bytes.Equal(ev.Body, config) {
+		t.Fatalf("plain value waited for with Compress: %d bytes, %v", len(ev.Body), err)
+	}
+
+	// A compressed value read by a client without Compress
+	// is the magic prefix and a gzip stream.
+	if _, err := c.Set("/packed", clobber, config); err != nil {
+		t.Fatal(err)
+	}
+	body, _, err = plain.Get("/packed", nil)
+	if err != nil || !bytes.HasPrefix(body, gzipMagic) {
+		t.Fatalf("compressed value read without Compress: %q %v", body, err)
+	}
+	if got, err := c.decode(body); err != nil || !bytes.Equal(got, config) {
+		t.Fatalf("decoding the raw body: %d bytes, %v", len(got), err)
+	}
+}
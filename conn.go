@@ -1,7 +1,7 @@
 package doozer
 
 import (
-	"code.google.com/p/goprotobuf/proto"
+	"bufio"
 	"encoding/binary"
 	"errors"
 	"github.com/kr/pretty"
@@ -9,16 +9,27 @@ import (
 
 	"io"
 	"log"
+	"math"
 	"math/rand"
 	"net"
 	"net/url"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 var (
 	uriPrefix = "doozer:?"
 )
 
+// maxFrame is the largest response frame c will read.
+// A bigger length prefix means the stream is corrupt.
+const maxFrame = 64 << 20
+
+// sendQueue is how many requests can wait for mux to write them.
+// Requests that arrive together are written with a single flush.
+const sendQueue = 64
+
 var (
 	ErrInvalidUri = errors.New("invalid uri")
 )
@@ -28,16 +39,87 @@ type txn struct {
 	resp *response
 	err  error
 	done chan bool
+	sent time.Time // set only when tracing
+
+	// If cancel is closed before the response arrives, the call
+	// returns ErrCancelled and mux forgets t. Nil means never.
+	cancel  <-chan bool
+	dropped bool // owned by mux; t was abandoned before it was sent
 }
 
+// A Conn is a connection to a doozer server.
+// Its exported fields are options; set them before using the Conn.
 type Conn struct {
+	lastRev  int64 // accessed atomically; keep 64-bit aligned
+	nread    int64 // accessed atomically
+	nwritten int64 // accessed atomically
+	revAt    int64 // accessed atomically; UnixNano of the last Rev for readRev
+	inflight int32 // accessed atomically
+	watches  int32 // accessed atomically
+	queued   int32 // accessed atomically
+
+	// If Compress is true, Set compresses bodies of at least
+	// CompressMin bytes (default 1024), and reads decompress
+	// bodies stored that way. A compressed body is stored as the
+	// bytes "\x00dzgz\x01" followed by a gzip stream of the body;
+	// a body without that prefix is read as is.
+	Compress    bool
+	CompressMin int
+
+	// If Trace is not nil, its callbacks are told about each request.
+	Trace *Trace
+
+	// If MaxInFlight is positive, at most that many calls are sent
+	// at once. Further calls wait for a slot, or fail with ErrBusy
+	// if FailFast is true. Wait doesn't count against the limit,
+	// since it may be outstanding for a long time. Of the control
+	// messages, only Nop is exempt, so a heartbeat never queues
+	// behind the calls it checks on; there is no CANCEL verb, and
+	// Watch.Cancel sends nothing, so it never waits for a slot.
+	// The limit is fixed by the first call; later changes to
+	// MaxInFlight have no effect.
+	MaxInFlight int
+	FailFast    bool
+
+	// GetMulti and SetMulti keep at most MultiWindow requests
+	// in flight at once (default 64).
+	MultiWindow int
+
+	// If ConsistentReads is true, a read given a nil rev reads at
+	// the highest revision c has seen, never an earlier one. The
+	// revision is refreshed with an extra Rev request before each
+	// read, or at most once per ReadWindow if that is positive.
+	ConsistentReads bool
+	ReadWindow      time.Duration
+
+	// If Debug is not nil, each frame sent or received is written
+	// to it as a one-line summary and a hex dump of up to 256 bytes.
+	Debug io.Writer
+
 	addr    string
 	conn    net.Conn
+	w       *bufio.Writer
 	send    chan *txn
-	msg     chan []byte
+	abandon chan *txn
+	msg     chan *response
 	err     error
 	stop    chan bool
 	stopped chan bool
+	verbs   map[request_Verb]*verbCount
+	sem     chan bool
+	semOnce sync.Once
+
+	// Tags are handed out by the caller, so Trace can be told of a
+	// request before mux has it. A tag stays in tags until mux has
+	// the response, or drops the request unsent.
+	tagmu   sync.Mutex
+	tags    map[int32]bool
+	nexttag int32
+
+	errmu   sync.Mutex
+	lastErr error
+
+	debugmu sync.Mutex
 }
 
 func init() {
@@ -55,26 +137,41 @@ func DialTimeout(addr string, timeout time.Duration) (*Conn, error) {
 }
 
 func dial(addr string, timeout time.Duration) (*Conn, error) {
-	var c Conn
+	var nc net.Conn
 	var err error
-	c.addr = addr
 	if timeout > 0 {
-		c.conn, err = net.DialTimeout("tcp", addr, timeout)
+		nc, err = net.DialTimeout("tcp", addr, timeout)
 	} else {
-		c.conn, err = net.Dial("tcp", addr)
+		nc, err = net.Dial("tcp", addr)
 	}
 	if err != nil {
 		return nil, err
 	}
 
-	c.send = make(chan *txn)
-	c.msg = make(chan []byte)
+	c := NewConn(nc)
+	c.addr = addr
+	return c, nil
+}
+
+// NewConn returns a Conn that speaks the doozer protocol over nc,
+// an established connection to a doozer server. It lets a caller
+// supply its own transport, such as one wrapped to inject faults.
+func NewConn(nc net.Conn) *Conn {
+	var c Conn
+	c.addr = nc.RemoteAddr().String()
+	c.conn = nc
+	c.w = bufio.NewWriter(c.conn)
+	c.send = make(chan *txn, sendQueue)
+	c.abandon = make(chan *txn)
+	c.msg = make(chan *response)
 	c.stop = make(chan bool, 1)
 	c.stopped = make(chan bool)
+	c.verbs = newVerbCounts()
+	c.tags = make(map[int32]bool)
 	errch := make(chan error, 1)
 	go c.mux(errch)
 	go c.readAll(errch)
-	return &c, nil
+	return &c
 }
 
 // DialUri connects to one of the doozer servers given in `uri`. If `uri`
@@ -165,14 +262,49 @@ func lookup(b *Conn, name string) (as []string, err error) {
 }
 
 func (c *Conn) call(t *txn) error {
-	t.done = make(chan bool)
+	switch t.req.GetVerb() {
+	case request_WAIT:
+		atomic.AddInt32(&c.watches, 1)
+		defer atomic.AddInt32(&c.watches, -1)
+	case request_NOP:
+		// A heartbeat must not queue behind the calls it checks on.
+	default:
+		if err := c.acquire(); err != nil {
+			c.count(t, err)
+			return err
+		}
+		defer c.release()
+	}
+	err := c.roundTrip(t)
+	c.count(t, err)
+	c.traceDone(t, err)
+	return err
+}
+
+func (c *Conn) roundTrip(t *txn) error {
+	atomic.AddInt32(&c.inflight, 1)
+	defer atomic.AddInt32(&c.inflight, -1)
+	t.done = make(chan bool, 1) // mux must never block on a departed caller
+	tag := c.newTag()
+	t.req.Tag = &tag
+	c.traceSent(t)
 	select {
 	case <-c.stopped:
+		c.freeTag(tag)
 		return c.err
+	case <-t.cancel:
+		c.freeTag(tag)
+		return ErrCancelled
 	case c.send <- t:
 		select {
 		case <-c.stopped:
 			return c.err
+		case <-t.cancel:
+			select {
+			case c.abandon <- t:
+			case <-c.stopped:
+			}
+			return ErrCancelled
 		case <-t.done:
 			if t.err != nil {
 				return t.err
@@ -186,6 +318,8 @@ func (c *Conn) call(t *txn) error {
 }
 
 // After Close is called, operations on c will return ErrClosed.
+// Close may be called more than once, and concurrently with the
+// server dropping the connection; mux alone tears c down, once.
 func (c *Conn) Close() {
 	select {
 	case c.stop <- true:
@@ -193,49 +327,73 @@ func (c *Conn) Close() {
 	}
 }
 
+// isStopped reports whether c has failed or been closed.
+func (c *Conn) isStopped() bool {
+	select {
+	case <-c.stopped:
+		return true
+	default:
+	}
+	return false
+}
+
 func (c *Conn) mux(errch chan error) {
 	txns := make(map[int32]*txn)
-	var n int32 // next tag
+	gone := make(map[int32]bool) // tags of abandoned txns still pending
 	var err error
 
 	for {
 		select {
 		case t := <-c.send:
-			// find an unused tag
-			for t := txns[n]; t != nil; t = txns[n] {
-				n++
-			}
-			txns[n] = t
-
-			// don't take n's address; it will change
-			tag := n
-			t.req.Tag = &tag
-
-			var buf []byte
-			buf, err = proto.Marshal(&t.req)
-			if err != nil {
-				txns[n] = nil
-				t.err = err
-				t.done <- true
-				continue
+			// A dropped t was abandoned while queued; don't send it.
+			tag := *t.req.Tag
+			if t.dropped {
+				c.freeTag(tag)
+			} else {
+				txns[tag] = t
+
+				var buf []byte
+				buf, err = marshal(&t.req)
+				if err != nil {
+					delete(txns, tag)
+					c.freeTag(tag)
+					t.err = err
+					t.done <- true
+				} else if err = c.write(buf); err != nil {
+					goto error
+				} else if c.Debug != nil {
+					c.dumpRequest(&t.req, buf)
+				}
 			}
 
-			err = c.write(buf)
-			if err != nil {
-				goto error
+			// Flush only once no other request is queued,
+			// so a burst of requests shares a few writes.
+			if len(c.send) == 0 {
+				if err = c.w.Flush(); err != nil {
+					goto error
+				}
 			}
-		case buf := <-c.msg:
-			var r response
-			err = proto.Unmarshal(buf, &r)
-			if err != nil {
-				log.Print(err)
-				continue
+		case t := <-c.abandon:
+			// The caller has given up on t. If t has been sent,
+			// forget it, but keep its tag out of use until the
+			// server answers, since the server can't be told
+			// to stop. Otherwise, don't send it at all.
+			if txns[*t.req.Tag] == t {
+				delete(txns, *t.req.Tag)
+				gone[*t.req.Tag] = true
+			} else {
+				t.dropped = true
 			}
-
+		case r := <-c.msg:
 			if r.Tag == nil {
 				log.Printf("nil tag: %# v", pretty.Formatter(r))
 				continue
 			}
+			if gone[*r.Tag] {
+				delete(gone, *r.Tag)
+				c.freeTag(*r.Tag)
+				continue
+			}
 			t := txns[*r.Tag]
 			if t == nil {
 				log.Printf("unexpected: %# v", pretty.Formatter(r))
@@ -243,7 +401,11 @@ func (c *Conn) mux(errch chan error) {
 			}
 
 			delete(txns, *r.Tag)
-			t.resp = &r
+			c.freeTag(*r.Tag)
+			if r.ErrCode == nil && r.GetRev() > atomic.LoadInt64(&c.lastRev) {
+				atomic.StoreInt64(&c.lastRev, r.GetRev())
+			}
+			t.resp = r
 			t.done <- true
 		case err = <-errch:
 			goto error
@@ -263,42 +425,113 @@ error:
 	close(c.stopped)
 }
 
+// newTag returns an unused tag and marks it in use. Tags are handed
+// out in order and not reused until they wrap around, so a late or
+// duplicate response can't be taken for the reply to a newer request.
+func (c *Conn) newTag() int32 {
+	c.tagmu.Lock()
+	defer c.tagmu.Unlock()
+	for c.tags[c.nexttag] {
+		c.nexttag = nextTag(c.nexttag)
+	}
+	tag := c.nexttag
+	c.tags[tag] = true
+	c.nexttag = nextTag(tag)
+	return tag
+}
+
+// freeTag lets tag be handed out again.
+func (c *Conn) freeTag(tag int32) {
+	c.tagmu.Lock()
+	delete(c.tags, tag)
+	c.tagmu.Unlock()
+}
+
+// nextTag returns the tag after n, wrapping to 0.
+func nextTag(n int32) int32 {
+	if n == math.MaxInt32 {
+		return 0
+	}
+	return n + 1
+}
+
 func (c *Conn) readAll(errch chan error) {
+	defer func() {
+		if v := recover(); v != nil {
+			errch <- recovered("readAll", v)
+		}
+	}()
+
+	var buf []byte
 	for {
-		buf, err := c.read()
+		var err error
+		buf, err = c.read(buf)
+		if err != nil {
+			errch <- err
+			return
+		}
+
+		// Unmarshal copies bytes fields out of buf,
+		// so buf can be reused for the next frame.
+		r := new(response)
+		err = unmarshal(buf, r)
+		if c.Debug != nil {
+			c.dumpResponse(r, buf, err)
+		}
 		if err != nil {
+			// the stream is out of sync or not doozer at all
 			errch <- err
 			return
 		}
 
-		c.msg <- buf
+		select {
+		case c.msg <- r:
+		case <-c.stopped:
+			return
+		}
 	}
 }
 
-func (c *Conn) read() ([]byte, error) {
-	var size int32
-	err := binary.Read(c.conn, binary.BigEndian, &size)
+// read reads one frame, reusing buf if it is big enough.
+func (c *Conn) read(buf []byte) ([]byte, error) {
+	var hdr [4]byte
+	_, err := io.ReadFull(c.conn, hdr[:])
 	if err != nil {
 		return nil, err
 	}
 
-	buf := make([]byte, size)
+	size := binary.BigEndian.Uint32(hdr[:])
+	if size > maxFrame {
+		return nil, ErrFrameSize
+	}
+	if int(size) > cap(buf) {
+		buf = make([]byte, size)
+	}
+	buf = buf[:size]
 	_, err = io.ReadFull(c.conn, buf)
 	if err != nil {
 		return nil, err
 	}
+	atomic.AddInt64(&c.nread, int64(4+size))
 
 	return buf, nil
 }
 
+// write buffers one frame; mux flushes c.w when it runs out of requests.
 func (c *Conn) write(buf []byte) error {
-	err := binary.Write(c.conn, binary.BigEndian, int32(len(buf)))
+	var hdr [4]byte
+	binary.BigEndian.PutUint32(hdr[:], uint32(len(buf)))
+	_, err := c.w.Write(hdr[:])
 	if err != nil {
 		return err
 	}
 
-	_, err = c.conn.Write(buf)
-	return err
+	_, err = c.w.Write(buf)
+	if err != nil {
+		return err
+	}
+	atomic.AddInt64(&c.nwritten, int64(4+len(buf)))
+	return nil
 }
 
 // Attempts access to the store
@@ -310,11 +543,12 @@ func (c *Conn) Access(token string) error {
 }
 
 // Sets the contents of file to body, if it hasn't been modified since oldRev.
+// A nil body stores an empty file, just as an empty one does.
 func (c *Conn) Set(file string, oldRev int64, body []byte) (newRev int64, err error) {
 	var t txn
 	t.req.Verb = request_SET.Enum()
 	t.req.Path = &file
-	t.req.Value = body
+	t.req.Value = c.encode(body)
 	t.req.Rev = &oldRev
 
 	err = c.call(&t)
@@ -325,13 +559,46 @@ func (c *Conn) Set(file string, oldRev int64, body []byte) (newRev int64, err er
 	return t.resp.GetRev(), nil
 }
 
+// SetGet acts like Set, but if the file has been modified since
+// oldRev, it also reads the file and returns the body and revision
+// that won, along with the error from Set. The read is pinned to the
+// revision the server sent with the error, if any. On success, or
+// any other error, cur is nil and curRev is 0. The Set is not retried.
+func (c *Conn) SetGet(file string, oldRev int64, body []byte) (newRev int64, cur []byte, curRev int64, err error) {
+	newRev, err = c.Set(file, oldRev, body)
+	if !IsConflict(err) {
+		return newRev, nil, 0, err
+	}
+
+	var rev *int64
+	if e, ok := err.(*Error); ok && e.Rev > 0 {
+		rev = &e.Rev
+	}
+	cur, curRev, gerr := c.Get(file, rev)
+	if gerr != nil {
+		return 0, nil, 0, err
+	}
+	return 0, cur, curRev, err
+}
+
 // Deletes file, if it hasn't been modified since rev.
 func (c *Conn) Del(file string, rev int64) error {
+	_, err := c.DelRev(file, rev)
+	return err
+}
+
+// DelRev acts like Del, but also returns the revision of the deletion.
+func (c *Conn) DelRev(file string, rev int64) (int64, error) {
 	var t txn
 	t.req.Verb = request_DEL.Enum()
 	t.req.Path = &file
 	t.req.Rev = &rev
-	return c.call(&t)
+
+	err := c.call(&t)
+	if err != nil {
+		return 0, err
+	}
+	return t.resp.GetRev(), nil
 }
 
 func (c *Conn) Nop() error {
@@ -343,30 +610,110 @@ func (c *Conn) Nop() error {
 // Returns the body and revision of the file at path,
 // as of store revision *rev.
 // If rev is nil, uses the current state.
+// The body of an empty file is a non-nil empty slice;
+// that of a missing file is nil.
 func (c *Conn) Get(file string, rev *int64) ([]byte, int64, error) {
+	return c.get(file, rev, nil)
+}
+
+// get does a GET of file at rev, sending offset if it is not nil.
+func (c *Conn) get(file string, rev *int64, offset *int32) ([]byte, int64, error) {
+	rev, err := c.readRev(rev)
+	if err != nil {
+		return nil, 0, err
+	}
+
 	var t txn
 	t.req.Verb = request_GET.Enum()
 	t.req.Path = &file
 	t.req.Rev = rev
+	t.req.Offset = offset
 
-	err := c.call(&t)
+	err = c.call(&t)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	body, err := c.decode(t.resp.Value)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	frev := t.resp.GetRev()
+	if frev > 0 {
+		body = nonNil(body)
+	}
+	return body, frev, nil
+}
+
+// GetRange acts like Get, but returns at most length bytes of the body,
+// starting at offset. A length of zero or less means to the end.
+// Like a read from a file, a range past the end of the body returns
+// a short or empty slice rather than an error.
+//
+// The server skips the first offset bytes of the body; GetRange
+// trims the rest to length, which the protocol has no field for.
+// With Compress set, offsets into the stored body don't match those
+// in the original, so GetRange reads it all and cuts out the range
+// itself.
+func (c *Conn) GetRange(file string, rev *int64, offset, length int) ([]byte, int64, error) {
+	if offset < 0 {
+		offset = 0
+	}
+	if c.Compress {
+		body, frev, err := c.Get(file, rev)
+		if err != nil {
+			return nil, 0, err
+		}
+		if offset > len(body) {
+			offset = len(body)
+		}
+		return trim(body[offset:], length), frev, nil
+	}
+
+	off := int32(offset)
+	body, frev, err := c.get(file, rev, &off)
 	if err != nil {
 		return nil, 0, err
 	}
+	return trim(body, length), frev, nil
+}
 
-	return t.resp.Value, t.resp.GetRev(), nil
+// trim returns the first n bytes of body, or all of it if n is
+// zero or less.
+func trim(body []byte, n int) []byte {
+	if n > 0 && n < len(body) {
+		return body[:n]
+	}
+	return body
+}
+
+// GetAtLeast acts like Get, but reads as of the highest revision
+// seen so far on c, so the result reflects every write made through c.
+// If c has not seen a revision yet, uses the current state.
+func (c *Conn) GetAtLeast(file string) ([]byte, int64, error) {
+	rev := c.LastRev()
+	if rev <= 0 {
+		return c.Get(file, nil)
+	}
+	return c.Get(file, &rev)
 }
 
 // Getdir reads up to lim names from dir, at revision rev, into an array.
 // Names are read in lexicographical order, starting at position off.
-// A negative lim means to read until the end.
+// A negative off means to start at the beginning, and a negative lim
+// means to read until the end, however many requests that takes.
 func (c *Conn) Getdir(dir string, rev int64, off, lim int) (names []string, err error) {
+	if off < 0 {
+		off = 0
+	}
 	for lim != 0 {
 		var t txn
 		t.req.Verb = request_GETDIR.Enum()
 		t.req.Rev = &rev
 		t.req.Path = &dir
-		t.req.Offset = proto.Int32(int32(off))
+		offset := int32(off)
+		t.req.Offset = &offset
 		err = c.call(&t)
 		if err, ok := err.(*Error); ok && err.Err == ErrRange {
 			return names, nil
@@ -374,7 +721,7 @@ func (c *Conn) Getdir(dir string, rev int64, off, lim int) (names []string, err
 		if err != nil {
 			return nil, err
 		}
-		names = append(names, *t.resp.Path)
+		names = append(names, t.resp.GetPath())
 		off++
 		lim--
 	}
@@ -420,16 +767,46 @@ func (c *Conn) Statinfo(rev int64, path string) (f *FileInfo, err error) {
 	if f.Rev == missing {
 		return nil, ErrNoEnt
 	}
+	f.Path = path
 	f.Name = basename(path)
 	f.IsSet = true
 	f.IsDir = f.Rev == dir
 	return f, nil
 }
 
+// GetInfo acts like Get, but returns the body along with the
+// file's metadata, all from one request. Len is the length of Body.
+// If there is no file at path, GetInfo returns ErrNoEnt.
+// Like Get, it fails on a directory; use Statinfo for those.
+func (c *Conn) GetInfo(path string, rev *int64) (*FileInfo, error) {
+	body, frev, err := c.Get(path, rev)
+	if err != nil {
+		return nil, err
+	}
+	if frev == missing {
+		return nil, ErrNoEnt
+	}
+	return &FileInfo{
+		Path:  path,
+		Name:  basename(path),
+		Len:   len(body),
+		Rev:   frev,
+		IsSet: true,
+		Body:  body,
+	}, nil
+}
+
 // Stat returns metadata about the file or directory at path,
 // in revision *storeRev. If storeRev is nil, uses the current
 // revision.
+// For a file, len is the length of its body; for a directory,
+// len is the number of entries and fileRev is dir.
 func (c *Conn) Stat(path string, storeRev *int64) (len int, fileRev int64, err error) {
+	storeRev, err = c.readRev(storeRev)
+	if err != nil {
+		return 0, 0, err
+	}
+
 	var t txn
 	t.req.Verb = request_STAT.Enum()
 	t.req.Path = &path
@@ -443,17 +820,37 @@ func (c *Conn) Stat(path string, storeRev *int64) (len int, fileRev int64, err e
 	return int(t.resp.GetLen()), t.resp.GetRev(), nil
 }
 
+// Exists reports whether a file or directory exists at path,
+// in revision *storeRev, and returns its revision.
+// If storeRev is nil, uses the current revision.
+// A missing path is not an error; Exists returns false and missing.
+func (c *Conn) Exists(path string, storeRev *int64) (bool, int64, error) {
+	_, rev, err := c.Stat(path, storeRev)
+	if err, ok := err.(*Error); ok && err.Err == ErrNoEnt {
+		return false, missing, nil
+	}
+	if err != nil {
+		return false, 0, err
+	}
+	return rev != missing, rev, nil
+}
+
 // Walk reads up to lim entries matching glob, in revision rev, into an array.
 // Entries are read in lexicographical order, starting at position off.
-// A negative lim means to read until the end.
+// A negative off means to start at the beginning, and a negative lim
+// means to read until the end, however many requests that takes.
 // Conn.Walk will be removed in a future release. Use Walk instead.
 func (c *Conn) Walk(glob string, rev int64, off, lim int) (info []Event, err error) {
+	if off < 0 {
+		off = 0
+	}
 	for lim != 0 {
 		var t txn
 		t.req.Verb = request_WALK.Enum()
 		t.req.Rev = &rev
 		t.req.Path = &glob
-		t.req.Offset = proto.Int32(int32(off))
+		offset := int32(off)
+		t.req.Offset = &offset
 		err = c.call(&t)
 		if err, ok := err.(*Error); ok && err.Err == ErrRange {
 			return info, nil
@@ -461,11 +858,18 @@ func (c *Conn) Walk(glob string, rev int64, off, lim int) (info []Event, err err
 		if err != nil {
 			return nil, err
 		}
+		var body []byte
+		body, err = c.decode(t.resp.Value)
+		if err != nil {
+			return nil, err
+		}
 		info = append(info, Event{
-			*t.resp.Rev,
-			*t.resp.Path,
-			t.resp.Value,
-			*t.resp.Flags,
+			Rev:       t.resp.GetRev(),
+			Path:      t.resp.GetPath(),
+			Name:      basename(t.resp.GetPath()),
+			Body:      nonNil(body),
+			Flag:      t.resp.GetFlags(),
+			Synthetic: true,
 		})
 		off++
 		lim--
@@ -475,38 +879,57 @@ func (c *Conn) Walk(glob string, rev int64, off, lim int) (info []Event, err err
 
 // Waits for the first change, on or after rev, to any file matching glob.
 func (c *Conn) Wait(glob string, rev int64) (ev Event, err error) {
+	return c.waitCancel(glob, rev, nil)
+}
+
+// waitCancel acts like Wait, but if cancel is closed first, it
+// abandons the wait and returns ErrCancelled.
+func (c *Conn) waitCancel(glob string, rev int64, cancel <-chan bool) (ev Event, err error) {
 	var t txn
 	t.req.Verb = request_WAIT.Enum()
 	t.req.Path = &glob
 	t.req.Rev = &rev
+	t.cancel = cancel
 
 	err = c.call(&t)
 	if err != nil {
 		return
 	}
 
-	ev.Rev = *t.resp.Rev
-	ev.Path = *t.resp.Path
-	ev.Body = t.resp.Value
-	ev.Flag = *t.resp.Flags & (set | del)
+	ev.Rev = t.resp.GetRev()
+	ev.Path = t.resp.GetPath()
+	ev.Name = basename(ev.Path)
+	ev.Body, err = c.decode(t.resp.Value)
+	if err != nil {
+		return Event{}, err
+	}
+	ev.Flag = t.resp.GetFlags() & (set | del)
+	if ev.IsSet() {
+		ev.Body = nonNil(ev.Body)
+	}
 	return
 }
 
 // Waits for the first change, on or after rev, to any file matching glob,
 // within the specific time expressed as time.Duration
+// If the timeout expires, WaitTimeout returns ErrWaitTimeout and c
+// remains usable. The abandoned wait holds no goroutine on c, but the
+// protocol has no way to cancel it, so the server keeps it open until
+// a matching change arrives, and c discards the response.
 func (c *Conn) WaitTimeout(glob string, rev int64, timeout time.Duration) (ev Event, err error) {
-	var timer *time.Timer
-	if timeout > 0 {
-		timer = time.AfterFunc(timeout, func() {
-			c.err = ErrWaitTimeout
-			c.stopped <- true
-		})
+	if timeout <= 0 {
+		return c.Wait(glob, rev)
 	}
-	ev, err = c.Wait(glob, rev)
-	if timer != nil {
-		timer.Stop()
+
+	cancel := make(chan bool)
+	timer := time.AfterFunc(timeout, func() { close(cancel) })
+	defer timer.Stop()
+
+	ev, err = c.waitCancel(glob, rev, cancel)
+	if err == ErrCancelled {
+		return Event{}, ErrWaitTimeout
 	}
-	return
+	return ev, err
 }
 
 // Rev returns the current revision of the store.
@@ -519,7 +942,13 @@ func (c *Conn) Rev() (int64, error) {
 		return 0, err
 	}
 
-	return *t.resp.Rev, nil
+	return t.resp.GetRev(), nil
+}
+
+// LastRev returns the highest revision seen in any successful
+// response on c, or 0 if there has been none.
+func (c *Conn) LastRev() int64 {
+	return atomic.LoadInt64(&c.lastRev)
 }
 
 // Self returns the node's identifier
@@ -0,0 +1,743 @@
+package doozer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ha/doozer/doozertest"
+)
+
+// newServer starts a doozertest server, closed when t ends.
+func newServer(t testing.TB) *doozertest.Server {
+	s, err := doozertest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	return s
+}
+
+// dialServer returns a Conn to s, closed when t ends.
+func dialServer(t testing.TB, s *doozertest.Server) *Conn {
+	c, err := Dial(s.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+	return c
+}
+
+// clientGoroutines counts the goroutines running code in this
+// package, leaving out those of the doozertest server.
+func clientGoroutines() int {
+	buf := make([]byte, 1<<20)
+	buf = buf[:runtime.Stack(buf, true)]
+	n := 0
+	for _, g := range strings.Split(string(buf), "\n\n") {
+		if strings.Contains(g, "ha/doozer.") && !strings.Contains(g, "doozertest.") {
+			n++
+		}
+	}
+	return n
+}
+
+// settle waits up to a second for f to report true.
+func settle(f func() bool) bool {
+	for i := 0; i < 100; i++ {
+		if f() {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return f()
+}
+
+func TestWaitTimeoutDoesntLeak(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+
+	rev, err := c.Rev()
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := clientGoroutines()
+	all := runtime.NumGoroutine()
+
+	for i := 0; i < 20; i++ {
+		_, err := c.WaitTimeout("/leak/**", rev+1, time.Millisecond)
+		if err != ErrWaitTimeout {
+			t.Fatalf("WaitTimeout: got %v, want ErrWaitTimeout", err)
+		}
+	}
+
+	if !settle(func() bool { return clientGoroutines() <= base }) {
+		t.Fatalf("client goroutines: %d, want at most %d", clientGoroutines(), base)
+	}
+	if n := c.Stats().Watches; n != 0 {
+		t.Fatalf("Watches: %d, want 0", n)
+	}
+
+	// The server answers all 20 abandoned waits at once;
+	// c must drop those responses and keep working.
+	frev, err := c.Set("/leak/a", clobber, []byte("x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev, err := c.Wait("/leak/**", rev+1)
+	if err != nil || ev.Rev != frev {
+		t.Fatalf("Wait: %v %v, want rev %d", ev, err, frev)
+	}
+	if !settle(func() bool { return runtime.NumGoroutine() <= all }) {
+		t.Fatalf("goroutines: %d, want at most %d", runtime.NumGoroutine(), all)
+	}
+}
+
+func TestWaitCancelledBeforeSend(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+
+	cancel := make(chan bool)
+	close(cancel)
+	_, err := c.waitCancel("/x", 1, cancel)
+	if err != ErrCancelled {
+		t.Fatalf("got %v, want ErrCancelled", err)
+	}
+	if err := c.Nop(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSetGetDel(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+
+	rev, err := c.Set("/a", 0, []byte("1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, frev, err := c.Get("/a", nil)
+	if err != nil || string(body) != "1" || frev != rev {
+		t.Fatalf("Get: %q %d %v, want %q %d", body, frev, err, "1", rev)
+	}
+
+	_, err = c.Set("/a", 0, []byte("2"))
+	if !IsConflict(err) {
+		t.Fatalf("Set at an old rev: got %v, want a conflict", err)
+	}
+	if e, ok := err.(*Error); !ok || e.Rev != rev {
+		t.Fatalf("conflict rev: %#v, want %d", err, rev)
+	}
+
+	body, frev, err = c.Get("/a", &rev)
+	if err != nil || string(body) != "1" {
+		t.Fatalf("Get at rev: %q %v", body, err)
+	}
+
+	err = c.Del("/a", rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, frev, err = c.Get("/a", nil)
+	if err != nil || body != nil || frev != missing {
+		t.Fatalf("Get after Del: %q %d %v", body, frev, err)
+	}
+	body, _, _ = c.Get("/a", &rev)
+	if string(body) != "1" {
+		t.Fatalf("Get at old rev after Del: %q", body)
+	}
+}
+
+func TestSetGet(t *testing.T) {
+	s, err := doozertest.NewUnstartedServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	other := make(chan *Conn, 1)
+	var once sync.Once
+	var norev int32
+	s.Fail = func(verb, path string) error {
+		switch verb + " " + path {
+		case "GET /a":
+			// A change after the conflict, which the pinned
+			// read must not see.
+			once.Do(func() {
+				if _, err := (<-other).Set("/a", clobber, []byte("later")); err != nil {
+					t.Error(err)
+				}
+			})
+		case "SET /isdir":
+			return doozertest.ErrIsDir
+		case "SET /a":
+			if atomic.LoadInt32(&norev) != 0 {
+				return doozertest.ErrOldRev
+			}
+		}
+		return nil
+	}
+	s.Start()
+	c := dialServer(t, s)
+	other <- dialServer(t, s)
+
+	old, err := c.Set("/a", clobber, []byte("1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rev, cur, curRev, err := c.SetGet("/a", old, []byte("2"))
+	if err != nil || rev <= old || cur != nil || curRev != 0 {
+		t.Fatalf("SetGet: %d %q %d %v, want a new rev and no body", rev, cur, curRev, err)
+	}
+
+	sets := c.Stats().Requests["SET"]
+	_, cur, curRev, err = c.SetGet("/a", old, []byte("3"))
+	if !IsConflict(err) {
+		t.Fatalf("SetGet at an old rev: got %v, want a conflict", err)
+	}
+	if string(cur) != "2" || curRev != rev {
+		t.Fatalf("SetGet conflict: %q %d, want the winner %q %d", cur, curRev, "2", rev)
+	}
+	if n := c.Stats().Requests["SET"] - sets; n != 1 {
+		t.Fatalf("SetGet sent %d SETs, want 1", n)
+	}
+
+	// With no rev on the error, the read is of the latest body.
+	atomic.StoreInt32(&norev, 1)
+	_, cur, curRev, err = c.SetGet("/a", clobber, []byte("x"))
+	if !IsConflict(err) || string(cur) != "later" || curRev <= rev {
+		t.Fatalf("SetGet with no rev on the conflict: %q %d %v", cur, curRev, err)
+	}
+
+	_, cur, curRev, err = c.SetGet("/isdir", clobber, []byte("x"))
+	if err == nil || IsConflict(err) || cur != nil || curRev != 0 {
+		t.Fatalf("SetGet with another error: %q %d %v", cur, curRev, err)
+	}
+}
+
+func TestDelRev(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+
+	old, err := c.Set("/a", clobber, []byte("1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cur, err := c.Set("/a", old, []byte("2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = c.DelRev("/a", old)
+	if !IsConflict(err) {
+		t.Fatalf("DelRev at an old rev: got %v, want a conflict", err)
+	}
+	if e, ok := err.(*Error); !ok || e.Rev != cur {
+		t.Fatalf("conflict rev: %#v, want %d", err, cur)
+	}
+
+	drev, err := c.DelRev("/a", cur)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rev, err := c.Rev(); err != nil || drev != rev || drev <= cur {
+		t.Fatalf("DelRev: %d, store at %d %v, want the store's rev after %d", drev, rev, err, cur)
+	}
+	ev, err := c.Wait("/a", cur+1)
+	if err != nil || !ev.IsDel() || ev.Rev != drev {
+		t.Fatalf("Wait after DelRev: %+v %v, want the delete at %d", ev, err, drev)
+	}
+
+	// A watcher can skip past its own delete.
+	rev, err := c.Set("/a", clobber, []byte("3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev, err = c.Wait("/a", drev+1)
+	if err != nil || ev.Rev != rev || string(ev.Body) != "3" {
+		t.Fatalf("Wait after the delete: %+v %v, want the set at %d", ev, err, rev)
+	}
+}
+
+func TestEmptyBody(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+
+	_, err := c.Set("/e", clobber, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, rev, err := c.Get("/e", nil)
+	if err != nil || body == nil || len(body) != 0 || rev <= 0 {
+		t.Fatalf("Get: %#v %d %v, want a non-nil empty body", body, rev, err)
+	}
+}
+
+func TestRevAndNop(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+
+	r0, err := c.Rev()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Nop(); err != nil {
+		t.Fatal(err)
+	}
+	r1, err := c.Rev()
+	if err != nil || r1 <= r0 {
+		t.Fatalf("Rev after Nop: %d %v, want more than %d", r1, err, r0)
+	}
+	if c.LastRev() < r1 {
+		t.Fatalf("LastRev: %d, want at least %d", c.LastRev(), r1)
+	}
+}
+
+func TestGetdirWalkStat(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+
+	for _, p := range []string{"/d/b", "/d/a", "/d/c/x"} {
+		if _, err := c.Set(p, clobber, []byte(p)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rev, _ := c.Rev()
+
+	names, err := c.Getdir("/d", rev, 0, -1)
+	if err != nil || strings.Join(names, ",") != "a,b,c" {
+		t.Fatalf("Getdir: %v %v", names, err)
+	}
+	names, err = c.Getdir("/d", rev, 1, 1)
+	if err != nil || strings.Join(names, ",") != "b" {
+		t.Fatalf("Getdir from 1: %v %v", names, err)
+	}
+
+	evs, err := c.Walk("/d/**", rev, 0, -1)
+	if err != nil || len(evs) != 3 || evs[0].Path != "/d/a" || evs[2].Name != "x" || string(evs[2].Body) != "/d/c/x" {
+		t.Fatalf("Walk: %v %v", evs, err)
+	}
+
+	n, frev, err := c.Stat("/d", &rev)
+	if err != nil || n != 3 || frev != dir {
+		t.Fatalf("Stat dir: %d %d %v", n, frev, err)
+	}
+	fi, err := c.Statinfo(rev, "/d/a")
+	if err != nil || fi.Len != 4 || fi.IsDir || fi.Name != "a" {
+		t.Fatalf("Statinfo: %+v %v", fi, err)
+	}
+	_, err = c.Statinfo(rev, "/d/nope")
+	if err != ErrNoEnt {
+		t.Fatalf("Statinfo missing: got %v, want ErrNoEnt", err)
+	}
+
+	infos, err := c.Getdirinfo("/d", rev, 0, -1)
+	if err != nil || len(infos) != 3 || !infos[2].IsDir {
+		t.Fatalf("Getdirinfo: %+v %v", infos, err)
+	}
+}
+
+func TestGetInfo(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+
+	r1, err := c.Set("/i/a", clobber, []byte("one"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r2, err := c.Set("/i/a", clobber, []byte("three"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gets := c.Stats().Requests["GET"]
+	fi, err := c.GetInfo("/i/a", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := c.Stats().Requests["GET"] - gets; n != 1 || c.Stats().Requests["STAT"] != 0 {
+		t.Fatalf("requests: %d GET, %d STAT; want one GET", n, c.Stats().Requests["STAT"])
+	}
+	if string(fi.Body) != "three" || fi.Path != "/i/a" || fi.Name != "a" ||
+		fi.Len != 5 || fi.Rev != r2 || !fi.IsSet || fi.IsDir {
+		t.Fatalf("GetInfo: %+v", fi)
+	}
+
+	// The metadata agrees with Statinfo's.
+	st, err := c.Statinfo(r2, "/i/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.Body = fi.Body
+	if !reflect.DeepEqual(st, fi) {
+		t.Fatalf("Statinfo %+v, GetInfo %+v", st, fi)
+	}
+
+	fi, err = c.GetInfo("/i/a", &r1)
+	if err != nil || string(fi.Body) != "one" || fi.Len != 3 || fi.Rev != r1 {
+		t.Fatalf("GetInfo at rev %d: %+v %v", r1, fi, err)
+	}
+
+	if _, err := c.GetInfo("/i/nope", nil); err != ErrNoEnt {
+		t.Fatalf("GetInfo of a missing file: %v, want ErrNoEnt", err)
+	}
+	if _, err := c.GetInfo("/i", nil); !isErr(err, ErrIsDir) {
+		t.Fatalf("GetInfo of a directory: %v, want ErrIsDir", err)
+	}
+
+	// An empty file is set, with a non-nil empty body.
+	if _, err := c.Set("/i/empty", clobber, nil); err != nil {
+		t.Fatal(err)
+	}
+	fi, err = c.GetInfo("/i/empty", nil)
+	if err != nil || !fi.IsSet || fi.Len != 0 || fi.Body == nil {
+		t.Fatalf("GetInfo of an empty file: %+v %v", fi, err)
+	}
+}
+
+func TestExists(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+
+	old, _ := c.Rev()
+	r1, err := c.Set("/e/a", clobber, []byte("body"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Set("/e/b", clobber, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	ok, rev, err := c.Exists("/e/a", nil)
+	if err != nil || !ok || rev != r1 {
+		t.Fatalf("Exists file: %v %d %v", ok, rev, err)
+	}
+	ok, rev, err = c.Exists("/e", nil)
+	if err != nil || !ok || rev != dir {
+		t.Fatalf("Exists dir: %v %d %v", ok, rev, err)
+	}
+	ok, rev, err = c.Exists("/e/nope", nil)
+	if err != nil || ok || rev != missing {
+		t.Fatalf("Exists missing: %v %d %v", ok, rev, err)
+	}
+	ok, rev, err = c.At(old).Exists("/e/a")
+	if err != nil || ok || rev != missing {
+		t.Fatalf("Exists at an old rev: %v %d %v", ok, rev, err)
+	}
+}
+
+func TestWait(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+
+	rev, _ := c.Rev()
+	go c.Set("/w/x", clobber, []byte("hi"))
+	ev, err := c.Wait("/w/*", rev+1)
+	if err != nil || !ev.IsSet() || ev.Path != "/w/x" || ev.Name != "x" || string(ev.Body) != "hi" {
+		t.Fatalf("Wait: %+v %v", ev, err)
+	}
+
+	go c.Del("/w/x", clobber)
+	ev, err = c.Wait("/w/*", ev.Rev+1)
+	if err != nil || !ev.IsDel() {
+		t.Fatalf("Wait for del: %+v %v", ev, err)
+	}
+}
+
+func TestAccess(t *testing.T) {
+	s, err := doozertest.NewUnstartedServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.Secret = "sekrit"
+	s.Start()
+
+	c := dialServer(t, s)
+	if _, err := c.Rev(); err == nil {
+		t.Fatal("Rev without access succeeded")
+	}
+	if err := c.Access("wrong"); err == nil {
+		t.Fatal("Access with a wrong secret succeeded")
+	}
+
+	c, err = DialUri(s.URI()+"&sk=sekrit", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// Requests race with one another on the server;
+	// run them together to check it under -race.
+	errc := make(chan error)
+	for i := 0; i < 10; i++ {
+		go func() {
+			_, err := c.Rev()
+			errc <- err
+		}()
+	}
+	for i := 0; i < 10; i++ {
+		if err := <-errc; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSelf(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+
+	id, err := c.Self()
+	if err != nil || string(id) != s.Self {
+		t.Fatalf("Self: %q %v, want %q", id, err, s.Self)
+	}
+}
+
+func TestClose(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+
+	c.Close()
+	c.Close()
+	if _, err := c.Rev(); err != ErrClosed {
+		t.Fatalf("Rev after Close: got %v, want ErrClosed", err)
+	}
+}
+
+// TestCloseConcurrent closes a Conn from 1000 goroutines at once,
+// while the server drops it and a call is in flight, many times.
+// Run it with -race.
+func TestCloseConcurrent(t *testing.T) {
+	s := newServer(t)
+	for i := 0; i < 20; i++ {
+		c := dialServer(t, s)
+		rev, err := c.Rev()
+		if err != nil {
+			t.Fatal(err)
+		}
+		errc := make(chan error)
+		go func() {
+			_, err := c.Wait("/never", rev+1)
+			errc <- err
+		}()
+		settle(func() bool { return c.Stats().Watches == 1 })
+
+		start := make(chan bool)
+		var wg sync.WaitGroup
+		for j := 0; j < 1000; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				c.Close()
+			}()
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			s.DropConns()
+		}()
+		close(start)
+		wg.Wait()
+
+		if err := <-errc; err == nil {
+			t.Fatal("Wait survived Close")
+		}
+		if _, err := c.Rev(); err == nil {
+			t.Fatal("Rev after Close succeeded")
+		}
+		c.Close()
+	}
+}
+
+func TestServerDrop(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+
+	rev, _ := c.Rev()
+	errc := make(chan error)
+	go func() {
+		_, err := c.Wait("/never", rev+1)
+		errc <- err
+	}()
+	settle(func() bool { return c.Stats().Watches == 1 })
+	s.DropConns()
+	if err := <-errc; err == nil {
+		t.Fatal("Wait survived a dropped connection")
+	}
+	if _, err := c.Rev(); err == nil {
+		t.Fatal("Rev on a dropped connection succeeded")
+	}
+}
+
+func TestGetRange(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+
+	rev, err := c.Set("/r", clobber, []byte("0123456789"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		off, n int
+		want   string
+	}{
+		{0, 0, "0123456789"},
+		{0, 4, "0123"},
+		{3, 4, "3456"},
+		{8, 4, "89"},
+		{-1, 2, "01"},
+		{10, 0, ""},
+		{99, 5, ""},
+	}
+	for _, tt := range tests {
+		body, frev, err := c.GetRange("/r", nil, tt.off, tt.n)
+		if err != nil || string(body) != tt.want || body == nil || frev != rev {
+			t.Errorf("GetRange(%d, %d): %q %d %v, want %q %d", tt.off, tt.n, body, frev, err, tt.want, rev)
+		}
+	}
+
+	body, frev, err := c.GetRange("/none", nil, 2, 2)
+	if err != nil || body != nil || frev != missing {
+		t.Fatalf("GetRange of a missing file: %q %d %v", body, frev, err)
+	}
+
+	// The same ranges of a compressed body, which can't be cut
+	// by the server.
+	c.Compress = true
+	c.CompressMin = 1
+	big := bytes.Repeat([]byte("0123456789"), 100)
+	rev, err = c.Set("/z", clobber, big)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _, _ := dialServer(t, s).Get("/z", nil)
+	if !bytes.HasPrefix(raw, gzipMagic) {
+		t.Fatalf("/z was stored uncompressed: %q", raw)
+	}
+	for _, tt := range tests {
+		want := ""
+		if off := tt.off; off < 0 {
+			want = string(big)
+		} else if off < len(big) {
+			want = string(big[off:])
+		}
+		if tt.n > 0 && tt.n < len(want) {
+			want = want[:tt.n]
+		}
+		body, frev, err := c.GetRange("/z", nil, tt.off, tt.n)
+		if err != nil || string(body) != want || frev != rev {
+			t.Errorf("compressed GetRange(%d, %d): %q %d %v, want %q %d", tt.off, tt.n, body, frev, err, want, rev)
+		}
+	}
+}
+
+func TestGetRangeSendsOffset(t *testing.T) {
+	client, server := net.Pipe()
+	c := NewConn(client)
+	defer c.Close()
+
+	done := make(chan *request)
+	go func() {
+		var req request
+		var hdr [4]byte
+		io.ReadFull(server, hdr[:])
+		buf := make([]byte, binary.BigEndian.Uint32(hdr[:]))
+		io.ReadFull(server, buf)
+		unmarshal(buf, &req)
+
+		// Answer with the body from the offset on.
+		flags, rev := int32(3), int64(5) // valid|done
+		buf, _ = marshal(&response{
+			Tag:   req.Tag,
+			Flags: &flags,
+			Rev:   &rev,
+			Value: []byte("0123456789")[req.GetOffset():],
+		})
+		binary.BigEndian.PutUint32(hdr[:], uint32(len(buf)))
+		server.Write(append(hdr[:], buf...))
+		done <- &req
+	}()
+
+	rev := int64(5)
+	body, _, err := c.GetRange("/r", &rev, 3, 2)
+	if err != nil || string(body) != "34" {
+		t.Fatalf("GetRange: %q %v, want %q", body, err, "34")
+	}
+	req := <-done
+	if req.Offset == nil || *req.Offset != 3 {
+		t.Fatalf("request offset: %v, want 3", req.Offset)
+	}
+}
+
+// BenchmarkGet reads a 1KB file. The doozertest server runs in the
+// same process, so its allocations are counted too.
+func BenchmarkGet(b *testing.B) {
+	s := newServer(b)
+	c := dialServer(b, s)
+	if _, err := c.Set("/b", clobber, make([]byte, 1024)); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := c.Get("/b", nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// countConn counts the writes made to a net.Conn.
+type countConn struct {
+	net.Conn
+	writes int64 // accessed atomically
+}
+
+func (c *countConn) Write(p []byte) (int, error) {
+	atomic.AddInt64(&c.writes, 1)
+	return c.Conn.Write(p)
+}
+
+// BenchmarkConcurrentSets makes 1000 small Sets at once, and reports
+// how many writes to the connection each Set costs. Bursts share
+// writes, so it is well under one.
+func BenchmarkConcurrentSets(b *testing.B) {
+	s := newServer(b)
+	nc, err := net.Dial("tcp", s.Addr)
+	if err != nil {
+		b.Fatal(err)
+	}
+	cc := &countConn{Conn: nc}
+	c := NewConn(cc)
+	b.Cleanup(c.Close)
+
+	const n = 1000
+	body := []byte("small")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var wg sync.WaitGroup
+		for j := 0; j < n; j++ {
+			wg.Add(1)
+			go func(j int) {
+				defer wg.Done()
+				if _, err := c.Set("/burst/"+strconv.Itoa(j), clobber, body); err != nil {
+					b.Error(err)
+				}
+			}(j)
+		}
+		wg.Wait()
+	}
+	b.StopTimer()
+	b.ReportMetric(float64(atomic.LoadInt64(&cc.writes))/float64(b.N*n), "writes/set")
+}
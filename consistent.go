@@ -0,0 +1,30 @@
+package doozer
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// readRev returns the store revision a read should use, given the
+// rev its caller passed: rev itself, unless rev is nil and
+// c.ConsistentReads is set. Then it is the highest revision c has
+// seen, refreshed with Rev unless the last refresh was within
+// c.ReadWindow. So reads on c never go back in time, even across
+// servers that lag one another.
+func (c *Conn) readRev(rev *int64) (*int64, error) {
+	if rev != nil || !c.ConsistentReads {
+		return rev, nil
+	}
+
+	at := atomic.LoadInt64(&c.revAt)
+	if c.ReadWindow <= 0 || at == 0 || time.Since(time.Unix(0, at)) >= c.ReadWindow {
+		_, err := c.Rev()
+		if err != nil {
+			return nil, err
+		}
+		atomic.StoreInt64(&c.revAt, time.Now().UnixNano())
+	}
+
+	r := c.LastRev()
+	return &r, nil
+}
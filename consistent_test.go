@@ -0,0 +1,82 @@
+package doozer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConsistentReads(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+	other := dialServer(t, s)
+
+	c.ConsistentReads = true
+	for i := 0; i < 5; i++ {
+		if _, _, err := c.Get("/a", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := c.Stats().Requests["REV"]; n != 5 {
+		t.Fatalf("REV requests with no window: %d, want 5", n)
+	}
+
+	c.ReadWindow = time.Hour
+	rev, err := other.Set("/a", clobber, []byte("new"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if _, _, err := c.Get("/a", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := c.Stats().Requests["REV"]; n != 5 {
+		t.Fatalf("REV requests within the window: %d, want still 5", n)
+	}
+
+	// Within the window, reads stay at the last revision c saw,
+	// even though the store has moved on.
+	body, frev, err := c.Get("/a", nil)
+	if err != nil || body != nil || frev != missing {
+		t.Fatalf("Get within the window: %q %d %v, want the old state", body, frev, err)
+	}
+	c.ReadWindow = 0
+	body, frev, err = c.Get("/a", nil)
+	if err != nil || string(body) != "new" || frev != rev {
+		t.Fatalf("Get after a refresh: %q %d %v", body, frev, err)
+	}
+}
+
+// benchmarkConsistentGet reads a file with ConsistentReads set
+// and the given window, and reports the REV requests per read.
+func benchmarkConsistentGet(b *testing.B, window time.Duration) {
+	s := newServer(b)
+	c := dialServer(b, s)
+	if _, err := c.Set("/b", clobber, make([]byte, 1024)); err != nil {
+		b.Fatal(err)
+	}
+	c.ConsistentReads = true
+	c.ReadWindow = window
+	revs := c.Stats().Requests["REV"]
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := c.Get("/b", nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+	n := c.Stats().Requests["REV"] - revs
+	b.ReportMetric(float64(n)/float64(b.N), "revs/op")
+}
+
+// BenchmarkGetConsistent refreshes the revision before every read.
+func BenchmarkGetConsistent(b *testing.B) {
+	benchmarkConsistentGet(b, 0)
+}
+
+// BenchmarkGetConsistentWindow refreshes it at most once a second.
+func BenchmarkGetConsistentWindow(b *testing.B) {
+	benchmarkConsistentGet(b, time.Second)
+}
@@ -0,0 +1,44 @@
+package doozer
+
+import (
+	"encoding/hex"
+	"fmt"
+)
+
+// debugMax is how many bytes of each frame Debug dumps.
+const debugMax = 256
+
+// dumpRequest writes a summary and hex dump of an outgoing
+// frame to c.Debug.
+func (c *Conn) dumpRequest(r *request, buf []byte) {
+	c.dump(fmt.Sprintf("> tag=%d verb=%s path=%q rev=%d len=%d offset=%d",
+		r.GetTag(), r.GetVerb(), r.GetPath(), r.GetRev(), len(r.Value), r.GetOffset()), buf)
+}
+
+// dumpResponse writes a summary and hex dump of an incoming
+// frame to c.Debug. If the frame could not be decoded, err
+// says why.
+func (c *Conn) dumpResponse(r *response, buf []byte, err error) {
+	if err != nil {
+		c.dump(fmt.Sprintf("< undecodable: %v", err), buf)
+		return
+	}
+	s := fmt.Sprintf("< tag=%d flags=%d path=%q rev=%d len=%d",
+		r.GetTag(), r.GetFlags(), r.GetPath(), r.GetRev(), len(r.Value))
+	if r.ErrCode != nil {
+		s += fmt.Sprintf(" err=%s %q", r.GetErrCode(), r.GetErrDetail())
+	}
+	c.dump(s, buf)
+}
+
+func (c *Conn) dump(summary string, buf []byte) {
+	c.debugmu.Lock()
+	defer c.debugmu.Unlock()
+	fmt.Fprintf(c.Debug, "%s frame=%d\n", summary, len(buf))
+	if len(buf) > debugMax {
+		fmt.Fprint(c.Debug, hex.Dump(buf[:debugMax]))
+		fmt.Fprintf(c.Debug, "... %d more bytes\n", len(buf)-debugMax)
+	} else {
+		fmt.Fprint(c.Debug, hex.Dump(buf))
+	}
+}
@@ -0,0 +1,113 @@
+package doozer
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// checkDump parses out, as written to Conn.Debug, and checks that
+// each summary line is followed by the whole hex dump of its frame,
+// with no other frame's lines in between. It returns the summaries.
+func checkDump(t *testing.T, out string) []string {
+	var sums []string
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	for i := 0; i < len(lines); {
+		sum := lines[i]
+		j := strings.LastIndex(sum, " frame=")
+		if j < 0 || (sum[0] != '>' && sum[0] != '<') {
+			t.Fatalf("line %d: not a summary: %q", i+1, sum)
+		}
+		n, err := strconv.Atoi(sum[j+len(" frame="):])
+		if err != nil {
+			t.Fatalf("line %d: %q: %v", i+1, sum, err)
+		}
+		sums = append(sums, sum[:j])
+		i++
+
+		shown := n
+		if shown > debugMax {
+			shown = debugMax
+		}
+		for off := 0; off < shown; off += 16 {
+			if i >= len(lines) || !strings.HasPrefix(lines[i], fmt.Sprintf("%08x  ", off)) {
+				t.Fatalf("line %d: want the dump at offset %#x of %q", i+1, off, sum)
+			}
+			i++
+		}
+		if n > debugMax {
+			if i >= len(lines) || lines[i] != fmt.Sprintf("... %d more bytes", n-debugMax) {
+				t.Fatalf("line %d: want the truncation of %q", i+1, sum)
+			}
+			i++
+		}
+	}
+	return sums
+}
+
+func TestDebug(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+	var out bytes.Buffer
+	c.Debug = &out
+
+	rev, err := c.Set("/a", clobber, []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Set("/a", 0, nil); !IsConflict(err) {
+		t.Fatalf("Set at an old rev: %v", err)
+	}
+	if _, err := c.Set("/big", clobber, bytes.Repeat([]byte("x"), 1000)); err != nil {
+		t.Fatal(err)
+	}
+
+	sums := checkDump(t, out.String())
+	want := []string{
+		`> tag=0 verb=SET path="/a" rev=-1 len=5 offset=0`,
+		fmt.Sprintf(`< tag=0 flags=3 path="" rev=%d len=0`, rev),
+		`> tag=1 verb=SET path="/a" rev=0 len=0 offset=0`,
+		fmt.Sprintf(`< tag=1 flags=3 path="" rev=%d len=0 err=REV_MISMATCH ""`, rev),
+		`> tag=2 verb=SET path="/big" rev=-1 len=1000 offset=0`,
+	}
+	if len(sums) != 6 {
+		t.Fatalf("summaries: %q", sums)
+	}
+	for i := range want {
+		if sums[i] != want[i] {
+			t.Errorf("summary %d: %q, want %q", i, sums[i], want[i])
+		}
+	}
+	if !strings.Contains(out.String(), "68 65 6c 6c 6f") {
+		t.Errorf("the body of the first Set is not in the dump:\n%s", out.String())
+	}
+}
+
+// TestDebugConcurrent checks that frames from concurrent calls,
+// written by both the writer and the reader, are never interleaved.
+func TestDebugConcurrent(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+	var out bytes.Buffer
+	c.Debug = &out
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			body := bytes.Repeat([]byte{byte(i)}, 10*i)
+			if _, err := c.Set("/c", clobber, body); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if sums := checkDump(t, out.String()); len(sums) != 100 {
+		t.Fatalf("%d frames dumped, want 100", len(sums))
+	}
+}
@@ -0,0 +1,63 @@
+package doozer
+
+import (
+	"io"
+)
+
+// defaultDirPage is the page size of a DirIterator
+// whose PageSize is not positive.
+const defaultDirPage = 100
+
+// A DirIterator reads the names in a directory a page at a time,
+// all at one revision, so entries added or removed meanwhile
+// cause no skips or repeats.
+type DirIterator struct {
+	PageSize int // names to read per page; default 100
+
+	c     *Conn
+	dir   string
+	rev   int64
+	off   int
+	names []string
+	eof   bool
+}
+
+// Dir returns a DirIterator over dir, at revision *rev,
+// or the current revision if rev is nil.
+func (c *Conn) Dir(dir string, rev *int64) (*DirIterator, error) {
+	r, err := c.pinRev(rev)
+	if err != nil {
+		return nil, err
+	}
+	return &DirIterator{c: c, dir: dir, rev: r}, nil
+}
+
+// Rev returns the revision it reads at.
+func (it *DirIterator) Rev() int64 {
+	return it.rev
+}
+
+// Next returns the next name in lexicographical order,
+// or io.EOF when there are no more.
+func (it *DirIterator) Next() (string, error) {
+	if len(it.names) == 0 && !it.eof {
+		n := it.PageSize
+		if n <= 0 {
+			n = defaultDirPage
+		}
+		names, err := it.c.Getdir(it.dir, it.rev, it.off, n)
+		if err != nil {
+			return "", err
+		}
+		it.off += len(names)
+		it.names = names
+		it.eof = len(names) < n
+	}
+	if len(it.names) == 0 {
+		return "", io.EOF
+	}
+
+	name := it.names[0]
+	it.names = it.names[1:]
+	return name, nil
+}
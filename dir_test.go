@@ -0,0 +1,53 @@
+package doozer
+
+import (
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestDirPaging(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+
+	// 10000 is not a multiple of the page size; 14 is.
+	for _, n := range []int{10000, 14, 1} {
+		dir := fmt.Sprintf("/dir%d", n)
+		ops := make([]SetOp, n)
+		for i := range ops {
+			ops[i] = SetOp{Path: fmt.Sprintf("%s/%05d", dir, i), OldRev: clobber}
+		}
+		if _, err := c.SetMulti(ops); err != nil {
+			t.Fatal(err)
+		}
+
+		it, err := c.Dir(dir, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		it.PageSize = 7
+
+		// Changes after the iterator's rev must not show.
+		c.Set(dir+"/00000a", clobber, nil)
+		c.Del(dir+"/00000", clobber)
+
+		for i := 0; ; i++ {
+			name, err := it.Next()
+			if err == io.EOF {
+				if i != n {
+					t.Fatalf("%s: %d names, want %d", dir, i, n)
+				}
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s: %v", dir, err)
+			}
+			if want := fmt.Sprintf("%05d", i); name != want {
+				t.Fatalf("%s: name %d is %q, want %q", dir, i, name, want)
+			}
+		}
+		if _, err := it.Next(); err != io.EOF {
+			t.Fatalf("%s: Next after the end: %v, want io.EOF", dir, err)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package doozer
+
+// A Doozer is the set of store operations provided by Conn.
+// Code that takes a Doozer rather than a *Conn can be tested
+// against a fake.
+type Doozer interface {
+	Get(file string, rev *int64) ([]byte, int64, error)
+	Set(file string, oldRev int64, body []byte) (int64, error)
+	Del(file string, rev int64) error
+	Stat(path string, storeRev *int64) (int, int64, error)
+	Statinfo(rev int64, path string) (*FileInfo, error)
+	Rev() (int64, error)
+	Getdir(dir string, rev int64, off, lim int) ([]string, error)
+	Getdirinfo(dir string, rev int64, off, lim int) ([]FileInfo, error)
+	Walk(glob string, rev int64, off, lim int) ([]Event, error)
+	Wait(glob string, rev int64) (Event, error)
+}
+
+var _ Doozer = (*Conn)(nil)
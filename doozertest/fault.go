@@ -0,0 +1,185 @@
+package doozertest
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// A FaultConn wraps the client side of a connection to a doozer server
+// and injects faults into the responses the client reads.
+// Pass it to doozer.NewConn. Requests are written through unchanged.
+//
+// Faults that name a tag apply to the response carrying that tag.
+// A Conn numbers its requests from 0.
+type FaultConn struct {
+	net.Conn
+
+	pr *io.PipeReader
+	pw *io.PipeWriter
+
+	mu        sync.Mutex
+	left      int // bytes to deliver before dropping; -1 for no limit
+	delay     map[int32]time.Duration
+	dup       map[int32]bool
+	after     map[int32]int32 // hold a response until another is sent
+	held      map[int32][]byte
+	corrupt   bool
+	delivered int
+}
+
+// NewFaultConn returns a FaultConn reading responses from c.
+func NewFaultConn(c net.Conn) *FaultConn {
+	f := &FaultConn{
+		Conn:  c,
+		left:  -1,
+		delay: make(map[int32]time.Duration),
+		dup:   make(map[int32]bool),
+		after: make(map[int32]int32),
+		held:  make(map[int32][]byte),
+	}
+	f.pr, f.pw = io.Pipe()
+	go f.pump()
+	return f
+}
+
+// DropAfter closes the connection once n more bytes
+// have been delivered to the client.
+func (f *FaultConn) DropAfter(n int) {
+	f.mu.Lock()
+	f.left = n
+	f.mu.Unlock()
+}
+
+// Delay holds the response for tag for d before delivering it,
+// letting later responses overtake it.
+func (f *FaultConn) Delay(tag int32, d time.Duration) {
+	f.mu.Lock()
+	f.delay[tag] = d
+	f.mu.Unlock()
+}
+
+// Duplicate delivers the response for tag twice.
+func (f *FaultConn) Duplicate(tag int32) {
+	f.mu.Lock()
+	f.dup[tag] = true
+	f.mu.Unlock()
+}
+
+// Reorder holds the response for tag a until
+// the response for tag b has been delivered.
+func (f *FaultConn) Reorder(a, b int32) {
+	f.mu.Lock()
+	f.after[b] = a
+	f.held[a] = nil
+	f.mu.Unlock()
+}
+
+// CorruptLength replaces the length prefix of the next response
+// with a bogus value.
+func (f *FaultConn) CorruptLength() {
+	f.mu.Lock()
+	f.corrupt = true
+	f.mu.Unlock()
+}
+
+// Delivered returns the number of bytes delivered to the client so far.
+func (f *FaultConn) Delivered() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.delivered
+}
+
+func (f *FaultConn) Read(p []byte) (int, error) {
+	return f.pr.Read(p)
+}
+
+func (f *FaultConn) Close() error {
+	f.pr.Close()
+	return f.Conn.Close()
+}
+
+func (f *FaultConn) pump() {
+	for {
+		frame, err := readFrame(f.Conn)
+		if err != nil {
+			f.pw.CloseWithError(err)
+			return
+		}
+
+		var r response
+		err = unmarshal(frame[4:], &r)
+		if err != nil || r.Tag == nil {
+			f.deliver(frame)
+			continue
+		}
+		f.route(*r.Tag, frame)
+	}
+}
+
+func (f *FaultConn) route(tag int32, frame []byte) {
+	f.mu.Lock()
+	d := f.delay[tag]
+	delete(f.delay, tag)
+	dup := f.dup[tag]
+	delete(f.dup, tag)
+	_, hold := f.held[tag]
+	if hold {
+		f.held[tag] = frame
+	}
+	a, release := f.after[tag]
+	var held []byte
+	if release {
+		held = f.held[a]
+		delete(f.after, tag)
+		delete(f.held, a)
+	}
+	f.mu.Unlock()
+
+	if hold {
+		return
+	}
+
+	send := func() {
+		f.deliver(frame)
+		if dup {
+			f.deliver(frame)
+		}
+		if held != nil {
+			f.deliver(held)
+		}
+	}
+	if d > 0 {
+		go func() {
+			time.Sleep(d)
+			send()
+		}()
+		return
+	}
+	send()
+}
+
+func (f *FaultConn) deliver(frame []byte) {
+	f.mu.Lock()
+	if f.corrupt {
+		f.corrupt = false
+		frame = append([]byte{0x7f, 0xff, 0xff, 0xff}, frame[4:]...)
+	}
+	drop := false
+	if f.left >= 0 && len(frame) >= f.left {
+		frame = frame[:f.left]
+		drop = true
+	}
+	if f.left >= 0 {
+		f.left -= len(frame)
+	}
+	f.delivered += len(frame)
+	f.mu.Unlock()
+
+	f.pw.Write(frame)
+	if drop {
+		f.pw.CloseWithError(io.ErrUnexpectedEOF)
+		f.Conn.Close()
+	}
+}
@@ -0,0 +1,160 @@
+package doozertest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Directions of a recorded frame.
+const (
+	ToServer = '>'
+	ToClient = '<'
+)
+
+// ErrMismatch is returned by a replay when the client
+// sends a request other than the one recorded.
+var ErrMismatch = errors.New("request does not match recording")
+
+// A Recorder wraps the client side of a connection to a doozer server
+// and writes every frame that crosses it to a log. Pass it to
+// doozer.NewConn.
+//
+// Each log record is a direction byte (ToServer or ToClient),
+// the time as big-endian int64 nanoseconds since the Unix epoch,
+// and the frame exactly as sent: a big-endian int32 length
+// followed by that many bytes.
+type Recorder struct {
+	net.Conn
+
+	mu   sync.Mutex
+	w    io.Writer
+	err  error
+	rbuf []byte
+	wbuf []byte
+}
+
+// NewRecorder returns a Recorder for c that logs to w.
+func NewRecorder(c net.Conn, w io.Writer) *Recorder {
+	return &Recorder{Conn: c, w: w}
+}
+
+// Err returns the first error writing to the log, if any.
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+func (r *Recorder) Read(p []byte) (int, error) {
+	n, err := r.Conn.Read(p)
+	r.mu.Lock()
+	r.rbuf = r.log(ToClient, append(r.rbuf, p[:n]...))
+	r.mu.Unlock()
+	return n, err
+}
+
+func (r *Recorder) Write(p []byte) (int, error) {
+	n, err := r.Conn.Write(p)
+	r.mu.Lock()
+	r.wbuf = r.log(ToServer, append(r.wbuf, p[:n]...))
+	r.mu.Unlock()
+	return n, err
+}
+
+// log writes each complete frame at the start of buf
+// and returns what is left. r.mu must be held.
+func (r *Recorder) log(dir byte, buf []byte) []byte {
+	for len(buf) >= 4 {
+		n := 4 + int(binary.BigEndian.Uint32(buf))
+		if len(buf) < n {
+			break
+		}
+
+		var hdr [9]byte
+		hdr[0] = dir
+		binary.BigEndian.PutUint64(hdr[1:], uint64(time.Now().UnixNano()))
+		if r.err == nil {
+			_, r.err = r.w.Write(hdr[:])
+		}
+		if r.err == nil {
+			_, r.err = r.w.Write(buf[:n])
+		}
+		buf = buf[n:]
+	}
+	return append([]byte(nil), buf...)
+}
+
+// Replay returns the client end of an in-process connection whose
+// server end plays back the recording read from log: it waits for
+// each recorded request and checks it matches byte for byte, then
+// sends each recorded response in order. Pass the result to
+// doozer.NewConn. The returned channel receives the outcome of the
+// replay: nil once the whole recording has been played, or the
+// error that stopped it.
+func Replay(log io.Reader) (net.Conn, <-chan error) {
+	client, server := net.Pipe()
+	errc := make(chan error, 1)
+	go func() {
+		errc <- replay(log, server)
+		server.Close()
+	}()
+	return client, errc
+}
+
+func replay(log io.Reader, c net.Conn) error {
+	for {
+		var hdr [9]byte
+		_, err := io.ReadFull(log, hdr[:])
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		frame, err := readFrame(log)
+		if err != nil {
+			return err
+		}
+
+		switch hdr[0] {
+		case ToServer:
+			got, err := readFrame(c)
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(got, frame) {
+				return ErrMismatch
+			}
+		case ToClient:
+			_, err = c.Write(frame)
+			if err != nil {
+				return err
+			}
+		default:
+			return errors.New("bad direction in recording")
+		}
+	}
+}
+
+// readFrame reads one length-prefixed frame, including its prefix.
+func readFrame(r io.Reader) ([]byte, error) {
+	var hdr [4]byte
+	_, err := io.ReadFull(r, hdr[:])
+	if err != nil {
+		return nil, err
+	}
+
+	frame := make([]byte, 4+binary.BigEndian.Uint32(hdr[:]))
+	copy(frame, hdr[:])
+	_, err = io.ReadFull(r, frame[4:])
+	if err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
@@ -0,0 +1,600 @@
+// Package doozertest provides an in-memory doozer server,
+// for testing code that uses package doozer without running doozerd.
+package doozertest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	valid = 1 << iota
+	done
+	set
+	del
+)
+
+const (
+	missing = int64(-iota)
+	clobber
+	dir
+)
+
+// Errors a Fail function can return to make the server
+// respond with the corresponding error code.
+var (
+	ErrOther    response_Err = response_OTHER
+	ErrNotDir   response_Err = response_NOTDIR
+	ErrIsDir    response_Err = response_ISDIR
+	ErrNoEnt    response_Err = response_NOENT
+	ErrRange    response_Err = response_RANGE
+	ErrOldRev   response_Err = response_REV_MISMATCH
+	ErrTooLate  response_Err = response_TOO_LATE
+	ErrReadonly response_Err = response_READONLY
+	ErrBadPath  response_Err = response_BAD_PATH
+)
+
+var errClosed = errors.New("server closed")
+
+// maxFrame is the largest request frame the server will read.
+// A bigger length prefix closes the connection.
+const maxFrame = 64 << 20
+
+type file struct {
+	body []byte
+	rev  int64
+}
+
+type change struct {
+	rev  int64
+	path string
+	body []byte
+	flag int32 // set, del, or 0 for a nop
+}
+
+// A Server is an in-memory doozer server listening on a local address.
+// Its store starts empty at revision 0. When a set or del fails with
+// ErrOldRev, the response carries the file's current revision.
+// A get with an offset returns the body from that offset on.
+// Its exported fields are options; to set them before any client
+// connects, use NewUnstartedServer and Start.
+type Server struct {
+	Addr string
+
+	// Delay, if nonzero, is how long the server waits
+	// before sending each response.
+	Delay time.Duration
+
+	// Fail, if non-nil, is called with the verb and path of each
+	// request. If it returns a non-nil error, the server responds with
+	// that error instead of handling the request. An error from this
+	// package's Err variables is sent as its code; any other error is
+	// sent as ErrOther with the error's text as the detail.
+	Fail func(verb, path string) error
+
+	// Secret, if non-empty, must be presented with ACCESS
+	// before any other request succeeds.
+	Secret string
+
+	// Self is returned by SELF.
+	Self string
+
+	l net.Listener
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	closed bool
+	rev    int64
+	cur    map[string]file
+	log    []change
+	conns  map[net.Conn]bool
+
+	// The contents as of snapRev, as last built by at, and the
+	// entries of the directories in it, as read so far. The log
+	// never changes below s.rev, so neither do these.
+	snapRev int64
+	snap    map[string]file
+	dirs    map[string][]string
+}
+
+// NewServer starts a Server listening on a local TCP port.
+func NewServer() (*Server, error) {
+	s, err := NewUnstartedServer()
+	if err != nil {
+		return nil, err
+	}
+	s.Start()
+	return s, nil
+}
+
+// NewUnstartedServer returns a Server listening on a local TCP port,
+// which serves no connections until Start is called. Its options
+// can be set in between, without racing with the connections.
+func NewUnstartedServer() (*Server, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		Addr:  l.Addr().String(),
+		Self:  "doozertest",
+		l:     l,
+		cur:   make(map[string]file),
+		conns: make(map[net.Conn]bool),
+	}
+	s.cond = sync.NewCond(&s.mu)
+	return s, nil
+}
+
+// Start starts serving connections to s.
+func (s *Server) Start() {
+	go s.accept()
+}
+
+// URI returns a doozer URI for s, suitable for doozer.DialUri.
+func (s *Server) URI() string {
+	return "doozer:?ca=" + s.Addr
+}
+
+// Close stops s and closes all its connections.
+func (s *Server) Close() {
+	s.l.Close()
+	s.mu.Lock()
+	s.closed = true
+	s.cond.Broadcast()
+	s.mu.Unlock()
+	s.DropConns()
+}
+
+// DropConns closes every open client connection,
+// as if the network had failed. s keeps accepting new ones.
+func (s *Server) DropConns() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.conns {
+		c.Close()
+		delete(s.conns, c)
+	}
+}
+
+// Rev returns the current revision of the store.
+func (s *Server) Rev() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rev
+}
+
+func (s *Server) accept() {
+	for {
+		c, err := s.l.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			c.Close()
+			return
+		}
+		s.conns[c] = true
+		s.mu.Unlock()
+
+		go s.serve(c)
+	}
+}
+
+type conn struct {
+	s      *Server
+	c      net.Conn
+	wl     sync.Mutex
+	access bool // guarded by s.mu
+}
+
+func (s *Server) serve(nc net.Conn) {
+	c := &conn{s: s, c: nc, access: s.Secret == ""}
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, nc)
+		s.mu.Unlock()
+		nc.Close()
+	}()
+
+	for {
+		var hdr [4]byte
+		_, err := io.ReadFull(nc, hdr[:])
+		if err != nil {
+			return
+		}
+
+		size := binary.BigEndian.Uint32(hdr[:])
+		if size > maxFrame {
+			return
+		}
+		buf := make([]byte, size)
+		_, err = io.ReadFull(nc, buf)
+		if err != nil {
+			return
+		}
+
+		var t request
+		err = unmarshal(buf, &t)
+		if err != nil {
+			return
+		}
+
+		go c.handle(&t)
+	}
+}
+
+func (c *conn) handle(t *request) {
+	var r response
+	if fail := c.s.Fail; fail != nil {
+		if err := fail(t.GetVerb().String(), t.GetPath()); err != nil {
+			c.respond(t, &r, err)
+			return
+		}
+	}
+
+	if !c.hasAccess() && t.GetVerb() != request_ACCESS {
+		c.respond(t, &r, ErrOther)
+		return
+	}
+
+	c.respond(t, &r, c.s.apply(c, t, &r))
+}
+
+// hasAccess reports whether c may make requests other than ACCESS.
+func (c *conn) hasAccess() bool {
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	return c.access
+}
+
+func (c *conn) respond(t *request, r *response, err error) {
+	if c.s.Delay > 0 {
+		time.Sleep(c.s.Delay)
+	}
+
+	r.Tag = t.Tag
+	r.Flags = newInt32(r.GetFlags() | valid | done)
+	if code, ok := err.(response_Err); ok {
+		r.ErrCode = &code
+	} else if err != nil {
+		r.ErrCode = response_OTHER.Enum()
+		r.ErrDetail = newString(err.Error())
+	}
+
+	buf, err := marshal(r)
+	if err != nil {
+		return
+	}
+
+	var hdr [4]byte
+	binary.BigEndian.PutUint32(hdr[:], uint32(len(buf)))
+
+	c.wl.Lock()
+	defer c.wl.Unlock()
+	_, err = c.c.Write(append(hdr[:], buf...))
+	if err != nil {
+		c.c.Close()
+	}
+}
+
+func (s *Server) apply(c *conn, t *request, r *response) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch t.GetVerb() {
+	case request_ACCESS:
+		if s.Secret != "" && string(t.Value) != s.Secret {
+			return ErrOther
+		}
+		c.access = true
+		return nil
+	case request_NOP:
+		s.commit("", nil, 0)
+		return nil
+	case request_REV:
+		r.Rev = newInt64(s.rev)
+		return nil
+	case request_SELF:
+		r.Value = []byte(s.Self)
+		return nil
+	case request_SET:
+		return s.set(t, r)
+	case request_DEL:
+		return s.del(t, r)
+	case request_WAIT:
+		return s.wait(t, r)
+	}
+
+	m, err := s.at(t.Rev)
+	if err != nil {
+		return err
+	}
+
+	path := t.GetPath()
+	switch t.GetVerb() {
+	case request_GET:
+		if isDir(m, path) {
+			return ErrIsDir
+		}
+		f := m[path]
+		off := int(t.GetOffset())
+		if off < 0 {
+			off = 0
+		}
+		if off > len(f.body) {
+			off = len(f.body)
+		}
+		r.Value = f.body[off:]
+		r.Rev = newInt64(f.rev)
+	case request_STAT:
+		if isDir(m, path) {
+			r.Len = newInt32(int32(len(s.children(t.Rev, m, path))))
+			r.Rev = newInt64(dir)
+		} else if f, ok := m[path]; ok {
+			r.Len = newInt32(int32(len(f.body)))
+			r.Rev = newInt64(f.rev)
+		} else {
+			r.Rev = newInt64(missing)
+		}
+	case request_GETDIR:
+		if _, ok := m[path]; ok {
+			return ErrNotDir
+		}
+		if !isDir(m, path) {
+			return ErrNoEnt
+		}
+		names := s.children(t.Rev, m, path)
+		off := int(t.GetOffset())
+		if off < 0 || off >= len(names) {
+			return ErrRange
+		}
+		r.Path = &names[off]
+	case request_WALK:
+		re, err := compileGlob(path)
+		if err != nil {
+			return err
+		}
+		var paths []string
+		for p := range m {
+			if re.MatchString(p) {
+				paths = append(paths, p)
+			}
+		}
+		sort.Strings(paths)
+		off := int(t.GetOffset())
+		if off < 0 || off >= len(paths) {
+			return ErrRange
+		}
+		f := m[paths[off]]
+		r.Path = &paths[off]
+		r.Value = f.body
+		r.Rev = newInt64(f.rev)
+		r.Flags = newInt32(set)
+	default:
+		return response_UNKNOWN_VERB
+	}
+	return nil
+}
+
+func (s *Server) set(t *request, r *response) error {
+	path := t.GetPath()
+	if !validPath(path) {
+		return ErrBadPath
+	}
+	if isDir(s.cur, path) {
+		return ErrIsDir
+	}
+	for p := parent(path); p != "/"; p = parent(p) {
+		if _, ok := s.cur[p]; ok {
+			return ErrNotDir
+		}
+	}
+
+	if rev := t.GetRev(); rev != clobber && rev < s.cur[path].rev {
+		r.Rev = newInt64(s.cur[path].rev)
+		return ErrOldRev
+	}
+
+	r.Rev = newInt64(s.commit(path, t.Value, set))
+	return nil
+}
+
+func (s *Server) del(t *request, r *response) error {
+	path := t.GetPath()
+	f, ok := s.cur[path]
+	if !ok {
+		if isDir(s.cur, path) {
+			return ErrIsDir
+		}
+		return ErrNoEnt
+	}
+
+	if rev := t.GetRev(); rev != clobber && rev < f.rev {
+		r.Rev = newInt64(f.rev)
+		return ErrOldRev
+	}
+
+	r.Rev = newInt64(s.commit(path, nil, del))
+	return nil
+}
+
+func (s *Server) wait(t *request, r *response) error {
+	re, err := compileGlob(t.GetPath())
+	if err != nil {
+		return err
+	}
+
+	from := t.GetRev()
+	i := 0
+	for {
+		for ; i < len(s.log); i++ {
+			ch := s.log[i]
+			if ch.rev >= from && ch.flag != 0 && re.MatchString(ch.path) {
+				r.Rev = newInt64(ch.rev)
+				r.Path = newString(ch.path)
+				r.Value = ch.body
+				r.Flags = newInt32(ch.flag)
+				return nil
+			}
+		}
+		if s.closed {
+			return errClosed
+		}
+		s.cond.Wait()
+	}
+}
+
+// commit applies a change at the next revision and returns it.
+// s.mu must be held.
+func (s *Server) commit(path string, body []byte, flag int32) int64 {
+	s.rev++
+	s.log = append(s.log, change{s.rev, path, body, flag})
+	switch flag {
+	case set:
+		s.cur[path] = file{body, s.rev}
+	case del:
+		delete(s.cur, path)
+	}
+	s.cond.Broadcast()
+	return s.rev
+}
+
+// at returns the store's contents as of *rev, or the current contents
+// if rev is nil, waiting for rev if it is in the future.
+// s.mu must be held.
+func (s *Server) at(rev *int64) (map[string]file, error) {
+	if rev == nil {
+		return s.cur, nil
+	}
+
+	for *rev > s.rev {
+		if s.closed {
+			return nil, errClosed
+		}
+		s.cond.Wait()
+	}
+	if *rev == s.rev {
+		return s.cur, nil
+	}
+	if s.snap != nil && *rev == s.snapRev {
+		return s.snap, nil
+	}
+
+	m := make(map[string]file)
+	for _, ch := range s.log {
+		if ch.rev > *rev {
+			break
+		}
+		switch ch.flag {
+		case set:
+			m[ch.path] = file{ch.body, ch.rev}
+		case del:
+			delete(m, ch.path)
+		}
+	}
+	s.snapRev, s.snap, s.dirs = *rev, m, make(map[string][]string)
+	return m, nil
+}
+
+// children returns the sorted names of the entries in directory
+// path of m, which at returned for rev.
+// s.mu must be held.
+func (s *Server) children(rev *int64, m map[string]file, path string) []string {
+	if rev == nil || *rev != s.snapRev || s.snap == nil || *rev == s.rev {
+		return children(m, path)
+	}
+	names, ok := s.dirs[path]
+	if !ok {
+		names = children(m, path)
+		s.dirs[path] = names
+	}
+	return names
+}
+
+func validPath(path string) bool {
+	return len(path) > 1 && path[0] == '/' && path[len(path)-1] != '/' &&
+		!strings.Contains(path, "//")
+}
+
+func parent(path string) string {
+	i := strings.LastIndex(path, "/")
+	if i <= 0 {
+		return "/"
+	}
+	return path[:i]
+}
+
+func isDir(m map[string]file, path string) bool {
+	if path == "/" {
+		return true
+	}
+	prefix := path + "/"
+	for p := range m {
+		if strings.HasPrefix(p, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// children returns the sorted names of the entries in directory path.
+func children(m map[string]file, path string) []string {
+	prefix := path + "/"
+	if path == "/" {
+		prefix = "/"
+	}
+
+	seen := make(map[string]bool)
+	var names []string
+	for p := range m {
+		if !strings.HasPrefix(p, prefix) {
+			continue
+		}
+		name := p[len(prefix):]
+		if i := strings.Index(name, "/"); i >= 0 {
+			name = name[:i]
+		}
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// compileGlob translates a doozer glob pattern to a regexp.
+// '?' and '*' match within one path component;
+// '**' matches across components.
+func compileGlob(glob string) (*regexp.Regexp, error) {
+	var b bytes.Buffer
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case glob[i] == '*':
+			b.WriteString("[^/]*")
+		case glob[i] == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
@@ -0,0 +1,36 @@
+package doozertest
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestFrameTooLarge(t *testing.T) {
+	s, err := NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	nc, err := net.Dial("tcp", s.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+
+	var hdr [4]byte
+	binary.BigEndian.PutUint32(hdr[:], maxFrame+1)
+	_, err = nc.Write(hdr[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nc.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = nc.Read(make([]byte, 1))
+	if err != io.EOF {
+		t.Fatalf("read: got %v, want io.EOF", err)
+	}
+}
@@ -0,0 +1,28 @@
+package doozertest
+
+import (
+	"code.google.com/p/goprotobuf/proto"
+)
+
+// marshal and unmarshal convert between messages and the bytes of
+// a frame. As in package doozer, they and msg.pb.go are all that
+// depends on the protobuf runtime.
+
+// A message is a *request or a *response.
+type message interface {
+	Reset()
+	String() string
+	ProtoMessage()
+}
+
+func marshal(m message) ([]byte, error) {
+	return proto.Marshal(m)
+}
+
+func unmarshal(buf []byte, m message) error {
+	return proto.Unmarshal(buf, m)
+}
+
+func newInt32(n int32) *int32    { return &n }
+func newInt64(n int64) *int64    { return &n }
+func newString(s string) *string { return &s }
@@ -0,0 +1,140 @@
+package doozer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// dumpPage is how many entries DumpTo reads per Walk call.
+const dumpPage = 100
+
+// ErrBadDump is returned by LoadFrom for a malformed dump.
+var ErrBadDump = errors.New("malformed dump")
+
+// DumpTo writes every file matching glob, as of the current revision,
+// to w. Files are written one at a time, so the tree need not fit in
+// memory.
+//
+// Each file is a record of: path length (big-endian uint32), path,
+// body length (big-endian uint32), body, and file revision
+// (big-endian int64).
+func (c *Conn) DumpTo(w io.Writer, glob string) error {
+	rev, err := c.Rev()
+	if err != nil {
+		return err
+	}
+
+	for off := 0; ; off += dumpPage {
+		evs, err := c.Walk(glob, rev, off, dumpPage)
+		if err != nil {
+			return err
+		}
+
+		for _, ev := range evs {
+			err = writeRecord(w, ev)
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(evs) < dumpPage {
+			return nil
+		}
+	}
+}
+
+// LoadFrom reads a dump written by DumpTo from r and sets each file
+// at prefix followed by its dumped path, overwriting whatever is there.
+// If prune is true, LoadFrom then deletes every file under prefix
+// that was not in the dump.
+func (c *Conn) LoadFrom(r io.Reader, prefix string, prune bool) error {
+	loaded := make(map[string]bool)
+	for {
+		ev, err := readRecord(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		path := prefix + ev.Path
+		_, err = c.Set(path, clobber, ev.Body)
+		if err != nil {
+			return err
+		}
+		loaded[path] = true
+	}
+
+	if !prune {
+		return nil
+	}
+
+	rev, err := c.Rev()
+	if err != nil {
+		return err
+	}
+
+	evs, err := c.Walk(prefix+"/**", rev, 0, -1)
+	if err != nil {
+		return err
+	}
+
+	for _, ev := range evs {
+		if !loaded[ev.Path] {
+			err = c.Del(ev.Path, clobber)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func writeRecord(w io.Writer, ev Event) error {
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, uint32(len(ev.Path)))
+	b.WriteString(ev.Path)
+	binary.Write(&b, binary.BigEndian, uint32(len(ev.Body)))
+	b.Write(ev.Body)
+	binary.Write(&b, binary.BigEndian, ev.Rev)
+	_, err := b.WriteTo(w)
+	return err
+}
+
+func readRecord(r io.Reader) (ev Event, err error) {
+	var n uint32
+	err = binary.Read(r, binary.BigEndian, &n)
+	if err == io.EOF {
+		return ev, err
+	}
+	if err != nil || n > maxFrame {
+		return ev, ErrBadDump
+	}
+
+	path := make([]byte, n)
+	_, err = io.ReadFull(r, path)
+	if err != nil {
+		return ev, ErrBadDump
+	}
+	ev.Path = string(path)
+
+	err = binary.Read(r, binary.BigEndian, &n)
+	if err != nil || n > maxFrame {
+		return ev, ErrBadDump
+	}
+
+	ev.Body = make([]byte, n)
+	_, err = io.ReadFull(r, ev.Body)
+	if err != nil {
+		return ev, ErrBadDump
+	}
+
+	err = binary.Read(r, binary.BigEndian, &ev.Rev)
+	if err != nil {
+		return ev, ErrBadDump
+	}
+	return ev, nil
+}
@@ -0,0 +1,108 @@
+package doozer
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// tree returns the path and body of every file in c.
+func tree(t *testing.T, c *Conn) map[string]string {
+	rev, err := c.Rev()
+	if err != nil {
+		t.Fatal(err)
+	}
+	evs, err := c.Walk("/**", rev, 0, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := make(map[string]string)
+	for _, ev := range evs {
+		m[ev.Path] = string(ev.Body)
+	}
+	return m
+}
+
+func TestDumpLoad(t *testing.T) {
+	src := dialServer(t, newServer(t))
+	files := map[string]string{
+		"/a":          "1",
+		"/empty":      "",
+		"/d/b":        "nested",
+		"/d/e/f/g":    "deep",
+		"/bin":        "\x00\xff\x00\n",
+		"/d/big":      string(bytes.Repeat([]byte("x"), 100000)),
+		"/with space": "s",
+	}
+	for p, b := range files {
+		if _, err := src.Set(p, clobber, []byte(b)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var dump bytes.Buffer
+	if err := src.DumpTo(&dump, "/**"); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := dialServer(t, newServer(t))
+	if err := dst.LoadFrom(bytes.NewReader(dump.Bytes()), "", false); err != nil {
+		t.Fatal(err)
+	}
+	if got := tree(t, dst); !reflect.DeepEqual(got, files) {
+		t.Fatalf("loaded tree differs:\n got %q\nwant %q", got, files)
+	}
+
+	// Load again under a prefix, pruning a file that was
+	// there before and keeping one outside the prefix.
+	dst.Set("/copy/stale", clobber, []byte("old"))
+	if err := dst.LoadFrom(bytes.NewReader(dump.Bytes()), "/copy", true); err != nil {
+		t.Fatal(err)
+	}
+	want := make(map[string]string)
+	for p, b := range files {
+		want[p] = b
+		want["/copy"+p] = b
+	}
+	if got := tree(t, dst); !reflect.DeepEqual(got, want) {
+		t.Fatalf("tree after a pruning load differs:\n got %q\nwant %q", got, want)
+	}
+}
+
+func TestDumpGlob(t *testing.T) {
+	c := dialServer(t, newServer(t))
+	c.Set("/keep/a", clobber, []byte("a"))
+	c.Set("/skip/b", clobber, []byte("b"))
+
+	var dump bytes.Buffer
+	if err := c.DumpTo(&dump, "/keep/**"); err != nil {
+		t.Fatal(err)
+	}
+	dst := dialServer(t, newServer(t))
+	if err := dst.LoadFrom(&dump, "", false); err != nil {
+		t.Fatal(err)
+	}
+	if got := tree(t, dst); !reflect.DeepEqual(got, map[string]string{"/keep/a": "a"}) {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestLoadBadDump(t *testing.T) {
+	c := dialServer(t, newServer(t))
+	c.Set("/a", clobber, []byte("body"))
+	var dump bytes.Buffer
+	if err := c.DumpTo(&dump, "/**"); err != nil {
+		t.Fatal(err)
+	}
+
+	for n := 1; n < dump.Len(); n++ {
+		err := c.LoadFrom(bytes.NewReader(dump.Bytes()[:n]), "/t", false)
+		if err != ErrBadDump {
+			t.Fatalf("dump cut to %d bytes: got %v, want ErrBadDump", n, err)
+		}
+	}
+	huge := []byte{0xff, 0xff, 0xff, 0xff}
+	if err := c.LoadFrom(bytes.NewReader(huge), "/t", false); err != ErrBadDump {
+		t.Fatalf("huge path length: got %v, want ErrBadDump", err)
+	}
+}
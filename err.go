@@ -2,6 +2,8 @@ package doozer
 
 import (
 	"errors"
+	"io"
+	"net"
 )
 
 var (
@@ -9,6 +11,9 @@ var (
 	ErrBadTag      = errors.New("bad tag")
 	ErrClosed      = errors.New("closed")
 	ErrWaitTimeout = errors.New("wait timeout")
+	ErrCancelled   = errors.New("cancelled")
+	ErrFrameSize   = errors.New("frame too large")
+	ErrBusy        = errors.New("too many requests in flight")
 )
 
 var (
@@ -25,12 +30,18 @@ var (
 type Error struct {
 	Err    error
 	Detail string
+
+	// Rev is the revision the server sent with the error, if any.
+	// With ErrOldRev, it may give the revision of the change that
+	// won, to read the file at.
+	Rev int64
 }
 
 func newError(t *txn) *Error {
 	return &Error{
 		Err:    *t.resp.ErrCode,
 		Detail: t.resp.GetErrDetail(),
+		Rev:    t.resp.GetRev(),
 	}
 }
 
@@ -41,3 +52,40 @@ func (e *Error) Error() (s string) {
 	}
 	return s
 }
+
+// isErr reports whether err is code, or an *Error with code.
+func isErr(err error, code response_Err) bool {
+	if e, ok := err.(*Error); ok {
+		return e.Err == code
+	}
+	e, ok := err.(response_Err)
+	return ok && e == code
+}
+
+// IsConflict reports whether err means a file changed since the
+// revision given to Set or Del. Retry only after reading a fresh rev.
+func IsConflict(err error) bool {
+	return isErr(err, ErrOldRev)
+}
+
+// IsTemporary reports whether the operation that returned err
+// may succeed if tried again, perhaps on a new connection:
+// network failures, timeouts, ErrBusy, ErrNoAddrs, and ErrTooLate,
+// which a Wait can retry from a later rev. Store errors such as
+// ErrOldRev and ErrNoEnt are permanent, as is ErrClosed.
+//
+// Conn never retries a request itself; callers must do the retrying,
+// redialing if the Conn has closed.
+func IsTemporary(err error) bool {
+	switch err.(type) {
+	case *Error, response_Err:
+		return isErr(err, ErrTooLate)
+	}
+
+	switch err {
+	case ErrNoAddrs, ErrWaitTimeout, ErrBusy, ErrFrameSize, io.EOF, io.ErrUnexpectedEOF:
+		return true
+	}
+	_, ok := err.(net.Error)
+	return ok
+}
@@ -0,0 +1,55 @@
+package doozer
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestErrorClasses(t *testing.T) {
+	type class struct {
+		err       error
+		temporary bool
+		conflict  bool
+	}
+	tests := []class{
+		{nil, false, false},
+		{ErrNoAddrs, true, false},
+		{ErrBadTag, false, false},
+		{ErrClosed, false, false},
+		{ErrWaitTimeout, true, false},
+		{ErrCancelled, false, false},
+		{ErrFrameSize, true, false},
+		{ErrBusy, true, false},
+		{ErrInvalidUri, false, false},
+		{ErrBadDump, false, false},
+		{ErrBadManifest, false, false},
+		{ErrChecksum, false, false},
+		{ErrNoGlobs, false, false},
+		{io.EOF, true, false},
+		{io.ErrUnexpectedEOF, true, false},
+		{errors.New("other"), false, false},
+		{&CodecError{"/a", errors.New("bad json")}, false, false},
+		{&net.OpError{Op: "read", Net: "tcp", Err: errors.New("reset")}, true, false},
+		{&net.DNSError{Err: "no such host", Name: "x", IsTimeout: true}, true, false},
+	}
+
+	// Every code the server can send, bare and as an *Error.
+	for n := range response_Err_name {
+		code := response_Err(n)
+		tests = append(tests,
+			class{code, code == ErrTooLate, code == ErrOldRev},
+			class{&Error{Err: code, Detail: "x"}, code == ErrTooLate, code == ErrOldRev},
+		)
+	}
+
+	for _, tt := range tests {
+		if got := IsTemporary(tt.err); got != tt.temporary {
+			t.Errorf("IsTemporary(%#v) = %v, want %v", tt.err, got, tt.temporary)
+		}
+		if got := IsConflict(tt.err); got != tt.conflict {
+			t.Errorf("IsConflict(%#v) = %v, want %v", tt.err, got, tt.conflict)
+		}
+	}
+}
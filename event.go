@@ -1,5 +1,11 @@
 package doozer
 
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
 const (
 	_ = 1 << iota
 	_
@@ -9,9 +15,28 @@ const (
 
 type Event struct {
 	Rev  int64
-	Path string
+	Path string // full path of the file
 	Body []byte
 	Flag int32
+
+	// Collapsed is the number of earlier events for Path that
+	// a Coalescer dropped in favor of this one.
+	Collapsed int
+
+	// Initial is true for an event from WatchWithCurrent
+	// describing a file's state when the watch began.
+	Initial bool
+
+	// Synthetic is true for an event the client made up from
+	// the result of a read, such as a Walk, rather than one
+	// received from a Wait. Initial events are synthetic.
+	Synthetic bool
+
+	// Truncated is true if Body was left out because the file
+	// is longer than the BodyLimit given to WalkWith.
+	Truncated bool
+
+	Name string // last element of Path
 }
 
 func (e Event) IsSet() bool {
@@ -21,3 +46,47 @@ func (e Event) IsSet() bool {
 func (e Event) IsDel() bool {
 	return e.Flag&del > 0
 }
+
+// IsDummy reports whether e is neither a set nor a del,
+// such as a nop event the server uses to advance the revision.
+func (e Event) IsDummy() bool {
+	return !e.IsSet() && !e.IsDel()
+}
+
+// Unmarshal decodes the JSON-encoded body of e into v.
+func (e Event) Unmarshal(v interface{}) error {
+	return json.Unmarshal(e.Body, v)
+}
+
+// String returns a one-line description of e for logging,
+// with the body truncated.
+func (e Event) String() string {
+	const max = 32
+	body := e.Body
+	more := ""
+	if len(body) > max {
+		body, more = body[:max], "..."
+	}
+	return fmt.Sprintf("%d %s %s %q%s", e.Rev, e.Path, FlagString(e.Flag), body, more)
+}
+
+// FlagString returns the names of the bits set in flag,
+// joined by "|", or "0" if there are none.
+func FlagString(flag int32) string {
+	var a []string
+	if flag&set > 0 {
+		a = append(a, "set")
+		flag &^= set
+	}
+	if flag&del > 0 {
+		a = append(a, "del")
+		flag &^= del
+	}
+	if flag != 0 {
+		a = append(a, fmt.Sprintf("%#x", flag))
+	}
+	if a == nil {
+		return "0"
+	}
+	return strings.Join(a, "|")
+}
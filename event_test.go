@@ -0,0 +1,117 @@
+package doozer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEventFlags(t *testing.T) {
+	tests := []struct {
+		flag         int32
+		isSet, isDel bool
+		isDummy      bool
+		name         string
+	}{
+		{0, false, false, true, "0"},
+		{set, true, false, false, "set"},
+		{del, false, true, false, "del"},
+		{set | del, true, true, false, "set|del"},
+		{1, false, false, true, "0x1"},
+		{set | 3, true, false, false, "set|0x3"},
+		{del | 0x10, false, true, false, "del|0x10"},
+	}
+	for _, tt := range tests {
+		e := Event{Flag: tt.flag}
+		if e.IsSet() != tt.isSet || e.IsDel() != tt.isDel || e.IsDummy() != tt.isDummy {
+			t.Errorf("flag %#x: IsSet %v, IsDel %v, IsDummy %v", tt.flag, e.IsSet(), e.IsDel(), e.IsDummy())
+		}
+		if s := FlagString(tt.flag); s != tt.name {
+			t.Errorf("FlagString(%#x) = %q, want %q", tt.flag, s, tt.name)
+		}
+	}
+}
+
+func TestEventString(t *testing.T) {
+	e := Event{Rev: 7, Path: "/a/b", Body: []byte("x\n"), Flag: set}
+	if s, want := e.String(), `7 /a/b set "x\n"`; s != want {
+		t.Errorf("String: %q, want %q", s, want)
+	}
+
+	e.Body = []byte(strings.Repeat("y", 40))
+	want := `7 /a/b set "` + strings.Repeat("y", 32) + `"...`
+	if s := e.String(); s != want {
+		t.Errorf("String of a long body: %q, want %q", s, want)
+	}
+}
+
+func TestEventUnmarshal(t *testing.T) {
+	var v struct{ Port int }
+	e := Event{Body: []byte(`{"port": 80}`)}
+	if err := e.Unmarshal(&v); err != nil || v.Port != 80 {
+		t.Fatalf("Unmarshal: %+v %v", v, err)
+	}
+
+	e.Body = []byte("not json")
+	if err := e.Unmarshal(&v); err == nil {
+		t.Fatal("Unmarshal of a bad body succeeded")
+	}
+}
+
+// TestEventSynthetic checks that events built from a read are marked
+// Synthetic, and events received from the server are not.
+func TestEventSynthetic(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+
+	rev, err := c.Set("/syn/a", clobber, []byte("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	evs, err := c.Walk("/syn/*", rev, 0, -1)
+	if err != nil || len(evs) != 1 || !evs[0].Synthetic {
+		t.Fatalf("Walk: %+v %v, want one synthetic event", evs, err)
+	}
+	evs, err = c.WalkWith("/syn/*", rev, WalkOptions{MaxDepth: 1})
+	if err != nil || len(evs) != 1 || !evs[0].Synthetic {
+		t.Fatalf("WalkWith: %+v %v, want one synthetic event", evs, err)
+	}
+	ev, err := c.Wait("/syn/*", rev)
+	if err != nil || ev.Synthetic {
+		t.Fatalf("Wait: %+v %v, want a live event", ev, err)
+	}
+
+	for _, glob := range []string{"/syn/*", "/syn/none"} {
+		w, err := c.WatchWithCurrent(glob)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ev, err := w.Next()
+		if err != nil || !ev.Initial || !ev.Synthetic {
+			t.Fatalf("initial event of %s: %+v %v, want it synthetic", glob, ev, err)
+		}
+		w.Cancel()
+	}
+
+	w, err := c.WatchWithCurrent("/syn/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Cancel()
+	if _, err := w.Next(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Set("/syn/b", clobber, []byte("b")); err != nil {
+		t.Fatal(err)
+	}
+	ev1, err := w.Next()
+	if err != nil || ev1.Initial || ev1.Synthetic {
+		t.Fatalf("live event of WatchWithCurrent: %+v %v", ev1, err)
+	}
+
+	co := c.Watch("/syn/*", rev).Coalesce()
+	defer co.Cancel()
+	ev1, err = co.Next()
+	if err != nil || ev1.Synthetic {
+		t.Fatalf("Coalescer event: %+v %v, want a live event", ev1, err)
+	}
+}
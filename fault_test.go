@@ -0,0 +1,153 @@
+package doozer
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ha/doozer/doozertest"
+)
+
+// dialFault returns a Conn to s whose responses pass through
+// a FaultConn.
+func dialFault(t *testing.T, s *doozertest.Server) (*Conn, *doozertest.FaultConn) {
+	nc, err := net.Dial("tcp", s.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := doozertest.NewFaultConn(nc)
+	c := NewConn(f)
+	t.Cleanup(c.Close)
+	return c, f
+}
+
+func TestFaultDrop(t *testing.T) {
+	s := newServer(t)
+	c, f := dialFault(t, s)
+
+	if _, err := c.Rev(); err != nil {
+		t.Fatal(err)
+	}
+	f.DropAfter(0)
+	if _, err := c.Rev(); err == nil {
+		t.Fatal("Rev on a dropped connection succeeded")
+	}
+	if _, err := c.Rev(); err == nil {
+		t.Fatal("Conn still usable after the drop")
+	}
+}
+
+func TestFaultShortFrame(t *testing.T) {
+	s := newServer(t)
+	c, f := dialFault(t, s)
+
+	if _, err := c.Set("/a", clobber, []byte("a body long enough to cut")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Cut the next response off partway through its body.
+	f.DropAfter(10)
+	_, _, err := c.Get("/a", nil)
+	if err == nil {
+		t.Fatal("Get of a truncated frame succeeded")
+	}
+	if !IsTemporary(err) {
+		t.Fatalf("got %v, want a temporary error", err)
+	}
+	if n := f.Delivered(); n == 0 {
+		t.Fatal("nothing delivered before the cut")
+	}
+}
+
+func TestFaultDelay(t *testing.T) {
+	s := newServer(t)
+	c, f := dialFault(t, s)
+
+	// Tag 0 is the first request: hold it back so the
+	// second request's response overtakes it.
+	f.Delay(0, 50*time.Millisecond)
+
+	type result struct {
+		rev int64
+		err error
+	}
+	first := make(chan result)
+	go func() {
+		rev, err := c.Set("/slow", clobber, []byte("1"))
+		first <- result{rev, err}
+	}()
+	settle(func() bool { return c.Stats().InFlight == 1 })
+
+	start := time.Now()
+	rev2, err := c.Set("/fast", clobber, []byte("2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d >= 50*time.Millisecond {
+		t.Fatalf("second Set took %v, waiting behind the delayed one", d)
+	}
+
+	r := <-first
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+	if r.rev == rev2 {
+		t.Fatalf("both Sets got rev %d; responses were mismatched", r.rev)
+	}
+	body, _, _ := c.Get("/slow", nil)
+	if string(body) != "1" {
+		t.Fatalf("/slow: %q", body)
+	}
+}
+
+func TestFaultDuplicate(t *testing.T) {
+	captureLog(t)
+	s := newServer(t)
+	c, f := dialFault(t, s)
+
+	f.Duplicate(0)
+	rev, err := c.Set("/a", clobber, []byte("1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The duplicate must not be taken for the next response.
+	body, frev, err := c.Get("/a", nil)
+	if err != nil || string(body) != "1" || frev != rev {
+		t.Fatalf("Get after a duplicate: %q %d %v", body, frev, err)
+	}
+	r, err := c.Rev()
+	if err != nil || r < rev {
+		t.Fatalf("Rev after a duplicate: %d %v", r, err)
+	}
+}
+
+func TestFaultReorder(t *testing.T) {
+	s := newServer(t)
+	c, f := dialFault(t, s)
+
+	f.Reorder(0, 1)
+	errc := make(chan error)
+	go func() {
+		_, err := c.Set("/a", clobber, []byte("a"))
+		errc <- err
+	}()
+	settle(func() bool { return c.Stats().InFlight == 1 })
+	if _, err := c.Set("/b", clobber, []byte("b")); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFaultCorruptLength(t *testing.T) {
+	s := newServer(t)
+	c, f := dialFault(t, s)
+
+	f.CorruptLength()
+	_, err := c.Rev()
+	if err != ErrFrameSize {
+		t.Fatalf("got %v, want ErrFrameSize", err)
+	}
+}
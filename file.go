@@ -7,12 +7,16 @@ const (
 	nop
 )
 
+// FileInfo describes a file or directory, as returned by Statinfo,
+// Getdirinfo and GetInfo.
 type FileInfo struct {
-	Name  string
-	Len   int
-	Rev   int64
+	Path  string
+	Name  string // base name
+	Len   int    // body length; for a directory, the number of entries
+	Rev   int64  // revision of the file; for a directory, dir
 	IsSet bool
 	IsDir bool
+	Body  []byte // set only by GetInfo
 }
 
 func basename(path string) string {
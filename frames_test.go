@@ -0,0 +1,171 @@
+package doozer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const framesFile = "testdata/frames.txt"
+
+// A vector is one entry of testdata/frames.txt.
+type vector struct {
+	line   int
+	kind   string // "request" or "response"
+	fields map[string]string
+	frame  []byte
+}
+
+func readVectors(t *testing.T) []vector {
+	data, err := ioutil.ReadFile(framesFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var vs []vector
+	var v *vector
+	for i, line := range strings.Split(string(data), "\n") {
+		switch {
+		case line == "":
+			v = nil
+		case strings.HasPrefix(line, "#"):
+		case v == nil:
+			f := strings.Fields(line)
+			vs = append(vs, vector{line: i + 1, kind: f[0], fields: map[string]string{}})
+			v = &vs[len(vs)-1]
+			for _, kv := range f[1:] {
+				j := strings.Index(kv, "=")
+				if j < 0 {
+					t.Fatalf("%s:%d: bad field %q", framesFile, i+1, kv)
+				}
+				v.fields[kv[:j]] = kv[j+1:]
+			}
+		default:
+			v.frame, err = hex.DecodeString(line)
+			if err != nil {
+				t.Fatalf("%s:%d: %v", framesFile, i+1, err)
+			}
+		}
+	}
+	if len(vs) == 0 {
+		t.Fatalf("%s: no vectors", framesFile)
+	}
+	return vs
+}
+
+// build fills msg, a *request or *response, from the documented
+// fields of v, by the names in their protobuf tags.
+func (v vector) build(t *testing.T, msg interface{}) {
+	rv := reflect.ValueOf(msg).Elem()
+	rt := rv.Type()
+	for name, s := range v.fields {
+		i := 0
+		for ; i < rt.NumField(); i++ {
+			if strings.Contains(rt.Field(i).Tag.Get("protobuf"), ",name="+name) {
+				break
+			}
+		}
+		if i == rt.NumField() {
+			t.Fatalf("%s:%d: no field %s in %s", framesFile, v.line, name, v.kind)
+		}
+
+		f := rv.Field(i)
+		var x interface{}
+		switch name {
+		case "verb":
+			n, ok := request_Verb_value[s]
+			if !ok {
+				t.Fatalf("%s:%d: bad verb %s", framesFile, v.line, s)
+			}
+			x = request_Verb(n)
+		case "err_code":
+			n, ok := response_Err_value[s]
+			if !ok {
+				t.Fatalf("%s:%d: bad err_code %s", framesFile, v.line, s)
+			}
+			x = response_Err(n)
+		default:
+			if strings.HasPrefix(s, `"`) {
+				u, err := strconv.Unquote(s)
+				if err != nil {
+					t.Fatalf("%s:%d: %v", framesFile, v.line, err)
+				}
+				if f.Type().Kind() == reflect.Slice {
+					f.Set(reflect.ValueOf([]byte(u)))
+					continue
+				}
+				x = u
+			} else {
+				n, err := strconv.ParseInt(s, 10, 64)
+				if err != nil {
+					t.Fatalf("%s:%d: %v", framesFile, v.line, err)
+				}
+				x = n
+			}
+		}
+		p := reflect.New(f.Type().Elem())
+		p.Elem().Set(reflect.ValueOf(x).Convert(f.Type().Elem()))
+		f.Set(p)
+	}
+}
+
+func TestRequestFrames(t *testing.T) {
+	for _, v := range readVectors(t) {
+		if v.kind != "request" {
+			continue
+		}
+		var req request
+		v.build(t, &req)
+
+		buf, err := marshal(&req)
+		if err != nil {
+			t.Fatalf("%s:%d: %v", framesFile, v.line, err)
+		}
+		var b bytes.Buffer
+		c := &Conn{w: bufio.NewWriter(&b)}
+		if err := c.write(buf); err != nil {
+			t.Fatal(err)
+		}
+		c.w.Flush()
+
+		if !bytes.Equal(b.Bytes(), v.frame) {
+			t.Errorf("%s:%d: %s\n got %x\nwant %x", framesFile, v.line, &req, b.Bytes(), v.frame)
+		}
+	}
+}
+
+func TestResponseFrames(t *testing.T) {
+	for _, v := range readVectors(t) {
+		if v.kind != "response" {
+			continue
+		}
+		var want response
+		v.build(t, &want)
+
+		client, server := net.Pipe()
+		go func() {
+			server.Write(v.frame)
+			server.Close()
+		}()
+		c := &Conn{conn: client}
+		buf, err := c.read(nil)
+		client.Close()
+		if err != nil {
+			t.Fatalf("%s:%d: %v", framesFile, v.line, err)
+		}
+
+		var got response
+		if err := unmarshal(buf, &got); err != nil {
+			t.Fatalf("%s:%d: %v", framesFile, v.line, err)
+		}
+		if !reflect.DeepEqual(&got, &want) {
+			t.Errorf("%s:%d:\n got %s\nwant %s", framesFile, v.line, &got, &want)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package doozer
+
+import (
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// A File is a read-only view of a doozer file or directory at one
+// revision, for code written against the io and os interfaces.
+// The body of a file is fetched on the first read.
+type File struct {
+	c    *Conn
+	rev  int64
+	info FileInfo
+
+	mu     sync.Mutex
+	body   []byte
+	loaded bool
+	off    int64
+	diroff int
+	closed bool
+}
+
+// Open returns a File for path, at revision *rev, or the current
+// revision if rev is nil. If there is nothing at path, the error
+// satisfies os.IsNotExist.
+func Open(c *Conn, path string, rev *int64) (*File, error) {
+	r, err := c.pinRev(rev)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := c.Statinfo(r, path)
+	if err == ErrNoEnt {
+		return nil, &os.PathError{Op: "open", Path: path, Err: os.ErrNotExist}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &File{c: c, rev: r, info: *fi}, nil
+}
+
+// load fetches f's body, if it hasn't been already.
+// f.mu must be held.
+func (f *File) load(op string) error {
+	if f.closed {
+		return &os.PathError{Op: op, Path: f.info.Path, Err: os.ErrInvalid}
+	}
+	if f.info.IsDir {
+		return &os.PathError{Op: op, Path: f.info.Path, Err: ErrIsDir}
+	}
+	if !f.loaded {
+		body, _, err := f.c.Get(f.info.Path, &f.rev)
+		if err != nil {
+			return err
+		}
+		f.body = body
+		f.loaded = true
+	}
+	return nil
+}
+
+// Read reads up to len(p) bytes of the body, implementing io.Reader.
+func (f *File) Read(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.load("read"); err != nil {
+		return 0, err
+	}
+	if f.off >= int64(len(f.body)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.body[f.off:])
+	f.off += int64(n)
+	return n, nil
+}
+
+// ReadAt reads len(p) bytes of the body starting at off,
+// implementing io.ReaderAt.
+func (f *File) ReadAt(p []byte, off int64) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.load("read"); err != nil {
+		return 0, err
+	}
+	if off < 0 {
+		return 0, &os.PathError{Op: "read", Path: f.info.Path, Err: os.ErrInvalid}
+	}
+	if off >= int64(len(f.body)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.body[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Readdir reads the next n entries of a directory, as os.File.Readdir
+// does: if n > 0, it returns at most n entries and io.EOF at the end;
+// otherwise it returns all remaining entries.
+func (f *File) Readdir(n int) ([]os.FileInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return nil, &os.PathError{Op: "readdir", Path: f.info.Path, Err: os.ErrInvalid}
+	}
+	if !f.info.IsDir {
+		return nil, &os.PathError{Op: "readdir", Path: f.info.Path, Err: ErrNotDir}
+	}
+
+	lim := n
+	if lim <= 0 {
+		lim = -1
+	}
+	a, err := f.c.Getdirinfo(f.info.Path, f.rev, f.diroff, lim)
+	if err != nil {
+		return nil, err
+	}
+	f.diroff += len(a)
+	if n > 0 && len(a) == 0 {
+		return nil, io.EOF
+	}
+
+	fis := make([]os.FileInfo, len(a))
+	for i := range a {
+		fis[i] = fileStat{a[i]}
+	}
+	return fis, nil
+}
+
+// Stat returns a description of f.
+func (f *File) Stat() (os.FileInfo, error) {
+	return fileStat{f.info}, nil
+}
+
+// Close releases f's body. Later reads fail.
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return &os.PathError{Op: "close", Path: f.info.Path, Err: os.ErrInvalid}
+	}
+	f.closed = true
+	f.body = nil
+	return nil
+}
+
+// fileStat adapts a FileInfo to os.FileInfo.
+// Sys returns the FileInfo.
+type fileStat struct {
+	fi FileInfo
+}
+
+func (s fileStat) Name() string       { return s.fi.Name }
+func (s fileStat) Size() int64        { return int64(s.fi.Len) }
+func (s fileStat) ModTime() time.Time { return time.Time{} }
+func (s fileStat) IsDir() bool        { return s.fi.IsDir }
+func (s fileStat) Sys() interface{}   { return &s.fi }
+
+func (s fileStat) Mode() os.FileMode {
+	if s.fi.IsDir {
+		return os.ModeDir | 0555
+	}
+	return 0444
+}
@@ -0,0 +1,194 @@
+package doozer
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestFileRead(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+
+	rev, err := c.Set("/f", clobber, []byte("0123456789"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := Open(c, "/f", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// The body is read as of Open, whatever happens later.
+	if _, err := c.Set("/f", rev, []byte("changed")); err != nil {
+		t.Fatal(err)
+	}
+
+	p := make([]byte, 4)
+	var got []string
+	for {
+		n, err := f.Read(p)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, string(p[:n]))
+	}
+	if len(got) != 3 || got[0] != "0123" || got[1] != "4567" || got[2] != "89" {
+		t.Fatalf("Reads of 4 bytes: %q", got)
+	}
+	if n, err := f.Read(p); n != 0 || err != io.EOF {
+		t.Fatalf("Read at the end: %d %v", n, err)
+	}
+
+	fi, err := f.Stat()
+	if err != nil || fi.Name() != "f" || fi.Size() != 10 || fi.IsDir() || fi.Mode() != 0444 {
+		t.Fatalf("Stat: %+v %v", fi, err)
+	}
+}
+
+func TestFileReadAt(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+
+	if _, err := c.Set("/f", clobber, []byte("0123456789")); err != nil {
+		t.Fatal(err)
+	}
+	f, err := Open(c, "/f", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	tests := []struct {
+		off  int64
+		n    int
+		want string
+		err  error
+	}{
+		{0, 4, "0123", nil},
+		{3, 4, "3456", nil},
+		{6, 4, "6789", nil},
+		{8, 4, "89", io.EOF},
+		{10, 4, "", io.EOF},
+		{99, 4, "", io.EOF},
+	}
+	for _, tt := range tests {
+		p := make([]byte, tt.n)
+		n, err := f.ReadAt(p, tt.off)
+		if string(p[:n]) != tt.want || err != tt.err {
+			t.Errorf("ReadAt(%d bytes, %d): %q %v, want %q %v", tt.n, tt.off, p[:n], err, tt.want, tt.err)
+		}
+	}
+	if _, err := f.ReadAt(make([]byte, 1), -1); err == nil {
+		t.Error("ReadAt a negative offset succeeded")
+	}
+
+	// ReadAt doesn't move the offset of Read.
+	b, err := ioutil.ReadAll(f)
+	if err != nil || string(b) != "0123456789" {
+		t.Fatalf("ReadAll after ReadAt: %q %v", b, err)
+	}
+}
+
+func TestOpenMissing(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+
+	_, err := Open(c, "/nope", nil)
+	if !os.IsNotExist(err) {
+		t.Fatalf("Open of a missing file: %v, want one satisfying os.IsNotExist", err)
+	}
+
+	// A file that exists now but not at an older revision.
+	rev, err := c.Rev()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Set("/later", clobber, []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	_, err = Open(c, "/later", &rev)
+	if !os.IsNotExist(err) {
+		t.Fatalf("Open at a rev before the file: %v, want one satisfying os.IsNotExist", err)
+	}
+}
+
+func TestFileReaddir(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+
+	for _, p := range []string{"/d/a", "/d/b", "/d/c/x"} {
+		if _, err := c.Set(p, clobber, []byte(p)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d, err := Open(c, "/d", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	fi, err := d.Stat()
+	if err != nil || !fi.IsDir() || fi.Size() != 3 || !fi.Mode().IsDir() {
+		t.Fatalf("Stat of a dir: %+v %v", fi, err)
+	}
+	if _, err := d.Read(make([]byte, 1)); err == nil {
+		t.Fatal("Read of a dir succeeded")
+	}
+
+	var names []string
+	for {
+		fis, err := d.Readdir(2)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(fis) > 2 {
+			t.Fatalf("Readdir(2) returned %d entries", len(fis))
+		}
+		for _, fi := range fis {
+			names = append(names, fi.Name())
+		}
+	}
+	if len(names) != 3 || names[0] != "a" || names[1] != "b" || names[2] != "c" {
+		t.Fatalf("Readdir names: %q", names)
+	}
+
+	d2, err := Open(c, "/d", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d2.Close()
+	fis, err := d2.Readdir(0)
+	if err != nil || len(fis) != 3 || !fis[2].IsDir() || fis[0].Size() != 4 {
+		t.Fatalf("Readdir(0): %v %v", fis, err)
+	}
+	fis, err = d2.Readdir(0)
+	if err != nil || len(fis) != 0 {
+		t.Fatalf("Readdir(0) at the end: %v %v", fis, err)
+	}
+
+	f, err := Open(c, "/d/a", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Readdir(0); err == nil {
+		t.Fatal("Readdir of a file succeeded")
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Read(make([]byte, 1)); err == nil {
+		t.Fatal("Read after Close succeeded")
+	}
+	if err := f.Close(); err == nil {
+		t.Fatal("second Close succeeded")
+	}
+}
@@ -0,0 +1,49 @@
+package doozer
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+)
+
+// FuzzResponseStream feeds data to a Conn as everything the server
+// sends, while the Conn makes a few calls. Whatever data holds, each
+// call must return, and no panic may be recovered on the way.
+// Regression inputs are in testdata/fuzz/FuzzResponseStream.
+func FuzzResponseStream(f *testing.F) {
+	f.Fuzz(func(t *testing.T, data []byte) {
+		captureLog(t)
+
+		var r response
+		if unmarshal(data, &r) == nil {
+			r.GetTag()
+			r.GetRev()
+			r.GetPath()
+			r.GetFlags()
+		}
+
+		client, server := net.Pipe()
+		go io.Copy(ioutil.Discard, server)
+		go func() {
+			server.Write(data)
+			server.Close()
+		}()
+
+		c := NewConn(client)
+		defer c.Close()
+		calls := []func() error{
+			func() error { _, err := c.Rev(); return err },
+			func() error { _, _, err := c.Get("/a", nil); return err },
+			func() error { _, err := c.Wait("/**", 1); return err },
+			func() error { _, err := c.Getdir("/", 1, 0, 2); return err },
+		}
+		for _, call := range calls {
+			err := call()
+			if err != nil && strings.Contains(err.Error(), "panic") {
+				t.Fatal(err)
+			}
+		}
+	})
+}
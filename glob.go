@@ -0,0 +1,31 @@
+package doozer
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+)
+
+// compileGlob translates a doozer glob pattern to a regexp,
+// for matching paths on the client side.
+// '?' and '*' match within one path component;
+// '**' matches across components.
+func compileGlob(glob string) (*regexp.Regexp, error) {
+	var b bytes.Buffer
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case glob[i] == '*':
+			b.WriteString("[^/]*")
+		case glob[i] == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
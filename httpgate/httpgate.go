@@ -0,0 +1,264 @@
+// Package httpgate serves a doozer store over HTTP.
+//
+// A Handler answers these requests:
+//
+//	GET /d/<path>[?rev=<rev>]
+//		Returns the body of the file, with its revision in the
+//		Doozer-Rev header. For a directory, returns the names
+//		of its entries, one per line, and sets Doozer-Dir.
+//	PUT /d/<path>
+//		Sets the file to the request body. With an If-Match header,
+//		the set succeeds only if the file's revision is not newer than
+//		the one given, and otherwise fails with 412. Returns the new
+//		revision in Doozer-Rev.
+//	DELETE /d/<path>
+//		Deletes the file, with If-Match as for PUT.
+//	GET /watch?glob=<glob>[&rev=<rev>]
+//		Waits for the next change on or after rev (default: the next
+//		revision) to a file matching glob, and returns it as a JSON
+//		object with fields rev, path, flag ("set" or "del"), and body
+//		(base64). If the client goes away first, the wait is
+//		abandoned.
+//
+// A Handler does no authentication of its own; wrap it to add some.
+package httpgate
+
+import (
+	"encoding/json"
+	"github.com/ha/doozer"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	revHeader = "Doozer-Rev"
+	dirHeader = "Doozer-Dir"
+)
+
+// clobber is the rev that sets or deletes a file unconditionally.
+const clobber = -1
+
+// A Handler serves the store behind a doozer connection over HTTP.
+type Handler struct {
+	c doozer.Doozer
+}
+
+// New returns a Handler that serves the store behind c.
+func New(c doozer.Doozer) *Handler {
+	return &Handler{c}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/d/"):
+		path := r.URL.Path[len("/d"):]
+		switch r.Method {
+		case "GET", "HEAD":
+			h.get(w, r, path)
+		case "PUT":
+			h.put(w, r, path)
+		case "DELETE":
+			h.del(w, r, path)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	case r.URL.Path == "/watch" && r.Method == "GET":
+		h.watch(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *Handler) get(w http.ResponseWriter, r *http.Request, path string) {
+	rev, err := h.rev(r.FormValue("rev"))
+	if err != nil {
+		fail(w, err)
+		return
+	}
+
+	body, frev, err := h.c.Get(path, &rev)
+	if isErr(err, doozer.ErrIsDir) {
+		names, err := h.c.Getdir(path, rev, 0, -1)
+		if err != nil {
+			fail(w, err)
+			return
+		}
+		w.Header().Set(dirHeader, "true")
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, name := range names {
+			w.Write([]byte(name + "\n"))
+		}
+		return
+	}
+	if err != nil {
+		fail(w, err)
+		return
+	}
+	if frev == 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set(revHeader, strconv.FormatInt(frev, 10))
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(body)
+}
+
+func (h *Handler) put(w http.ResponseWriter, r *http.Request, path string) {
+	oldRev, ok := ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rev, err := h.c.Set(path, oldRev, body)
+	if err != nil {
+		fail(w, err)
+		return
+	}
+
+	w.Header().Set(revHeader, strconv.FormatInt(rev, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) del(w http.ResponseWriter, r *http.Request, path string) {
+	oldRev, ok := ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.c.Del(path, oldRev)
+	if err != nil {
+		fail(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type event struct {
+	Rev  int64  `json:"rev"`
+	Path string `json:"path"`
+	Flag string `json:"flag"`
+	Body []byte `json:"body"`
+}
+
+func (h *Handler) watch(w http.ResponseWriter, r *http.Request) {
+	glob := r.FormValue("glob")
+	if glob == "" {
+		http.Error(w, "missing glob", http.StatusBadRequest)
+		return
+	}
+
+	var rev int64
+	if s := r.FormValue("rev"); s != "" {
+		var err error
+		rev, err = strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			http.Error(w, "bad rev", http.StatusBadRequest)
+			return
+		}
+	} else {
+		cur, err := h.c.Rev()
+		if err != nil {
+			fail(w, err)
+			return
+		}
+		rev = cur + 1
+	}
+
+	wt := doozer.NewWatch(h.c, glob, rev)
+	if cn, ok := w.(http.CloseNotifier); ok {
+		done := make(chan bool)
+		defer close(done)
+		gone := cn.CloseNotify()
+		go func() {
+			select {
+			case <-gone:
+				wt.Cancel()
+			case <-done:
+			}
+		}()
+	}
+
+	ev, err := wt.Next()
+	if err == io.EOF {
+		return // client went away
+	}
+	if err != nil {
+		fail(w, err)
+		return
+	}
+
+	e := event{Rev: ev.Rev, Path: ev.Path, Body: ev.Body}
+	switch {
+	case ev.IsSet():
+		e.Flag = "set"
+	case ev.IsDel():
+		e.Flag = "del"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(e)
+}
+
+// rev parses s as a revision, or returns the current revision
+// if s is empty.
+func (h *Handler) rev(s string) (int64, error) {
+	if s == "" {
+		return h.c.Rev()
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
+
+// ifMatch returns the revision in r's If-Match header, or clobber
+// if there is none. If the header is malformed, it responds to r
+// and returns false.
+func ifMatch(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	s := strings.Trim(r.Header.Get("If-Match"), `"`)
+	if s == "" {
+		return clobber, true
+	}
+
+	rev, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		http.Error(w, "bad If-Match", http.StatusBadRequest)
+		return 0, false
+	}
+	return rev, true
+}
+
+func isErr(err error, code error) bool {
+	e, ok := err.(*doozer.Error)
+	return ok && e.Err == code
+}
+
+func fail(w http.ResponseWriter, err error) {
+	code := http.StatusBadGateway
+	if e, ok := err.(*doozer.Error); ok {
+		switch e.Err {
+		case doozer.ErrNoEnt:
+			code = http.StatusNotFound
+		case doozer.ErrOldRev:
+			code = http.StatusPreconditionFailed
+		case doozer.ErrIsDir, doozer.ErrNotDir:
+			code = http.StatusConflict
+		case doozer.ErrRange:
+			code = http.StatusBadRequest
+		}
+	}
+	if doozer.IsTemporary(err) {
+		code = http.StatusServiceUnavailable
+	}
+	if _, ok := err.(*strconv.NumError); ok {
+		code = http.StatusBadRequest
+	}
+	http.Error(w, err.Error(), code)
+}
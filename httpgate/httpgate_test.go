@@ -0,0 +1,176 @@
+package httpgate
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ha/doozer"
+	"github.com/ha/doozer/doozertest"
+)
+
+// newGate returns a Conn to a fresh doozertest server and an
+// httptest server running a Handler on it, all closed when t ends.
+func newGate(t *testing.T) (*doozer.Conn, *httptest.Server) {
+	s, err := doozertest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	c, err := doozer.Dial(s.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs := httptest.NewServer(New(c))
+	t.Cleanup(hs.Close)
+	t.Cleanup(c.Close) // first, to end any handler still waiting
+	return c, hs
+}
+
+func do(t *testing.T, method, url, ifMatch, body string) *http.Response {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestMatrix(t *testing.T) {
+	c, hs := newGate(t)
+
+	rev, err := c.Set("/a", -1, []byte("one"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Set("/dir/x", -1, []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	r := strconv.FormatInt(rev, 10)
+	old := strconv.FormatInt(rev-1, 10)
+
+	tests := []struct {
+		method, path, ifMatch, body string
+
+		code    int
+		resp    string // if not empty, the expected response body
+		headers map[string]string
+	}{
+		{"GET", "/d/a", "", "", 200, "one", map[string]string{revHeader: r}},
+		{"HEAD", "/d/a", "", "", 200, "", map[string]string{revHeader: r}},
+		{"GET", "/d/a?rev=" + r, "", "", 200, "one", nil},
+		{"GET", "/d/a?rev=" + old, "", "", 404, "", nil},
+		{"GET", "/d/a?rev=x", "", "", 400, "", nil},
+		{"GET", "/d/missing", "", "", 404, "", nil},
+		{"GET", "/d/dir", "", "", 200, "x\n", map[string]string{dirHeader: "true"}},
+		{"PUT", "/d/empty", "", "", 204, "", nil},
+		{"GET", "/d/empty", "", "", 200, "", nil},
+		{"PUT", "/d/a", "nope", "two", 400, "", nil},
+		{"PUT", "/d/a", old, "two", 412, "", nil},
+		{"PUT", "/d/dir", "", "two", 409, "", nil},
+		{"PUT", "/d/b", "", "new", 204, "", nil},
+		{"PUT", "/d/a", `"` + r + `"`, "two", 204, "", nil},
+		{"GET", "/d/a", "", "", 200, "two", nil},
+		{"DELETE", "/d/a", old, "", 412, "", nil},
+		{"DELETE", "/d/a", "", "", 204, "", nil},
+		{"GET", "/d/a", "", "", 404, "", nil},
+		{"POST", "/d/a", "", "", 405, "", nil},
+		{"GET", "/nowhere", "", "", 404, "", nil},
+		{"POST", "/watch", "", "", 404, "", nil},
+		{"GET", "/watch", "", "", 400, "", nil},
+		{"GET", "/watch?glob=/**&rev=x", "", "", 400, "", nil},
+	}
+	for _, tt := range tests {
+		resp := do(t, tt.method, hs.URL+tt.path, tt.ifMatch, tt.body)
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tt.code {
+			t.Errorf("%s %s: %d %q, want %d", tt.method, tt.path, resp.StatusCode, body, tt.code)
+			continue
+		}
+		if tt.resp != "" && string(body) != tt.resp {
+			t.Errorf("%s %s: body %q, want %q", tt.method, tt.path, body, tt.resp)
+		}
+		for k, v := range tt.headers {
+			if got := resp.Header.Get(k); got != v {
+				t.Errorf("%s %s: %s: %q, want %q", tt.method, tt.path, k, got, v)
+			}
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	c, hs := newGate(t)
+
+	rev, err := c.Set("/w/a", -1, []byte("hi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An event already past returns at once.
+	resp := do(t, "GET", hs.URL+"/watch?glob=/w/*&rev="+strconv.FormatInt(rev, 10), "", "")
+	var e event
+	err = json.NewDecoder(resp.Body).Decode(&e)
+	resp.Body.Close()
+	if err != nil || e.Rev != rev || e.Path != "/w/a" || e.Flag != "set" || string(e.Body) != "hi" {
+		t.Fatalf("watch: %+v %v", e, err)
+	}
+
+	// Without rev, the handler waits for the next change.
+	done := make(chan event)
+	go func() {
+		resp := do(t, "GET", hs.URL+"/watch?glob=/w/*", "", "")
+		defer resp.Body.Close()
+		var e event
+		json.NewDecoder(resp.Body).Decode(&e)
+		done <- e
+	}()
+	waitWatches(t, c, 1)
+	if err := c.Del("/w/a", -1); err != nil {
+		t.Fatal(err)
+	}
+	if e := <-done; e.Path != "/w/a" || e.Flag != "del" || e.Rev <= rev {
+		t.Fatalf("long-poll: %+v", e)
+	}
+}
+
+func TestWatchClientGone(t *testing.T) {
+	c, hs := newGate(t)
+
+	for i := 0; i < 10; i++ {
+		nc, err := net.Dial("tcp", hs.Listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := bufio.NewWriter(nc)
+		w.WriteString("GET /watch?glob=/gone/** HTTP/1.1\r\nHost: x\r\n\r\n")
+		w.Flush()
+		waitWatches(t, c, 1)
+		nc.Close()
+		waitWatches(t, c, 0)
+	}
+}
+
+// waitWatches waits for c to have n waits outstanding.
+func waitWatches(t *testing.T, c *doozer.Conn, n int) {
+	for i := 0; i < 100; i++ {
+		if c.Stats().Watches == n {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Watches: %d, want %d", c.Stats().Watches, n)
+}
@@ -0,0 +1,45 @@
+package doozer
+
+import (
+	"sync/atomic"
+)
+
+// acquire takes one of c's MaxInFlight slots, if c has a limit.
+// If none is free, it waits for one, or returns ErrBusy if
+// c.FailFast is set. The limit is read once, by the first call;
+// after that only c.sem says whether there is one.
+func (c *Conn) acquire() error {
+	c.semOnce.Do(func() {
+		if c.MaxInFlight > 0 {
+			c.sem = make(chan bool, c.MaxInFlight)
+		}
+	})
+	if c.sem == nil {
+		return nil
+	}
+
+	select {
+	case c.sem <- true:
+		return nil
+	default:
+	}
+	if c.FailFast {
+		return ErrBusy
+	}
+
+	atomic.AddInt32(&c.queued, 1)
+	defer atomic.AddInt32(&c.queued, -1)
+	select {
+	case c.sem <- true:
+		return nil
+	case <-c.stopped:
+		return c.err
+	}
+}
+
+// release gives back a slot taken by acquire.
+func (c *Conn) release() {
+	if c.sem != nil {
+		<-c.sem
+	}
+}
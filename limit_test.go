@@ -0,0 +1,164 @@
+package doozer
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMaxInFlight(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+	c.MaxInFlight = 64
+
+	// 10k Sets, from half as many goroutines: the race
+	// detector allows at most 8128 goroutines at once.
+	const calls, workers = 10000, 5000
+
+	stop := make(chan bool)
+	var peak, queued int32
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			st := c.Stats()
+			if n := int32(st.InFlight); n > atomic.LoadInt32(&peak) {
+				atomic.StoreInt32(&peak, n)
+			}
+			if st.Queued > 0 {
+				atomic.StoreInt32(&queued, 1)
+			}
+			time.Sleep(time.Microsecond)
+		}
+	}()
+
+	var wg sync.WaitGroup
+	var failed int32
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < calls/workers; j++ {
+				if _, err := c.Set("/limit", clobber, nil); err != nil {
+					atomic.AddInt32(&failed, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(stop)
+
+	if failed > 0 {
+		t.Fatalf("%d Sets failed", failed)
+	}
+	if p := atomic.LoadInt32(&peak); p > 64 {
+		t.Fatalf("peak in flight: %d, want at most 64", p)
+	}
+	if atomic.LoadInt32(&queued) == 0 {
+		t.Fatal("no call ever queued for a slot")
+	}
+	if n := c.Stats().Requests["SET"]; n != calls {
+		t.Fatalf("SET requests: %d, want %d", n, calls)
+	}
+}
+
+func TestFailFast(t *testing.T) {
+	s := newServer(t)
+	c, f := dialFault(t, s)
+	c.MaxInFlight = 1
+	c.FailFast = true
+
+	f.Delay(0, 100*time.Millisecond)
+	errc := make(chan error)
+	go func() {
+		_, err := c.Set("/slow", clobber, nil)
+		errc <- err
+	}()
+	settle(func() bool { return c.Stats().InFlight == 1 })
+
+	if _, err := c.Set("/fast", clobber, nil); err != ErrBusy {
+		t.Fatalf("Set with the limit reached: got %v, want ErrBusy", err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Set("/fast", clobber, nil); err != nil {
+		t.Fatalf("Set after a slot freed: %v", err)
+	}
+}
+
+func TestLimitExemptions(t *testing.T) {
+	s := newServer(t)
+	c, f := dialFault(t, s)
+	c.MaxInFlight = 2
+
+	rev, err := c.Rev()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := c.Watch("/exempt", rev+1)
+	werr := make(chan error)
+	go func() {
+		_, err := w.Next()
+		werr <- err
+	}()
+	settle(func() bool { return c.Stats().Watches == 1 })
+
+	// Fill both slots with Sets whose responses are held back,
+	// and queue a third behind them.
+	f.Delay(2, time.Second)
+	f.Delay(3, time.Second)
+	for i := 0; i < 3; i++ {
+		go c.Set("/slow", clobber, nil)
+	}
+	if !settle(func() bool { return c.Stats().Queued == 1 }) {
+		t.Fatalf("limit not saturated: %+v", c.Stats())
+	}
+
+	start := time.Now()
+	if err := c.Nop(); err != nil {
+		t.Fatal(err)
+	}
+	w.Cancel()
+	if err := <-werr; err == nil {
+		t.Fatal("Next after Cancel returned an event")
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Fatalf("Nop and Cancel took %v behind the limit", d)
+	}
+}
+
+// TestMaxInFlightFixed checks that the limit in force is the one
+// set before the first call, whatever MaxInFlight says later.
+func TestMaxInFlightFixed(t *testing.T) {
+	s := newServer(t)
+	c, f := dialFault(t, s)
+	c.MaxInFlight = 1
+	c.FailFast = true
+	if _, err := c.Set("/first", clobber, nil); err != nil {
+		t.Fatal(err)
+	}
+	c.MaxInFlight = 0
+
+	f.Delay(1, 100*time.Millisecond)
+	errc := make(chan error)
+	go func() {
+		_, err := c.Set("/slow", clobber, nil)
+		errc <- err
+	}()
+	settle(func() bool { return c.Stats().InFlight == 1 })
+
+	if _, err := c.Set("/fast", clobber, nil); err != ErrBusy {
+		t.Fatalf("Set with the first limit reached: got %v, want ErrBusy", err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Set("/fast", clobber, nil); err != nil {
+		t.Fatalf("Set after the slot freed: %v", err)
+	}
+}
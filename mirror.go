@@ -0,0 +1,183 @@
+package doozer
+
+import (
+	"bytes"
+	"log"
+	"sync/atomic"
+)
+
+// Conflict policies for a Mirror, applied when a file in the
+// destination has changed since the Mirror last wrote it.
+const (
+	Overwrite = iota // log the conflict and overwrite the file
+	Skip             // log the conflict and leave the file alone, this once
+)
+
+// A Mirror copies the files matching Glob from Src to Dst, under Prefix,
+// then follows changes in Src and applies them to Dst.
+type Mirror struct {
+	rev int64 // accessed atomically; keep 64-bit aligned
+
+	Src, Dst Doozer
+	Glob     string
+	Prefix   string // prepended to each path written to Dst
+	Policy   int    // Overwrite or Skip
+
+	// From, if nonzero, is the last revision already mirrored,
+	// as returned by Rev from an earlier run. Run then skips the
+	// initial copy and applies changes after From.
+	From int64
+
+	// Log, if not nil, receives a line for each conflict.
+	// Otherwise they go to the standard logger.
+	Log *log.Logger
+
+	revs map[string]int64 // Dst revision of each file m wrote
+}
+
+// dstRev returns the revision of path in Dst that m last wrote, or
+// that it last chose to leave alone. If m has done neither since Run
+// began, as when resuming from From, the baseline is src, the file in
+// Src as of prev, the last revision mirrored: Dst is unchanged if it
+// holds the same body. dstRev reports false if Dst has changed.
+func (m *Mirror) dstRev(path, src string, prev int64) (int64, bool, error) {
+	if rev, ok := m.revs[path]; ok {
+		return rev, true, nil
+	}
+	body, rev, err := m.Dst.Get(path, nil)
+	if err != nil {
+		return 0, false, err
+	}
+	want, srcRev, err := m.Src.Get(src, &prev)
+	if err != nil {
+		return 0, false, err
+	}
+	if (rev == missing) != (srcRev == missing) || !bytes.Equal(body, want) {
+		return 0, false, nil
+	}
+	return rev, true, nil
+}
+
+// conflict logs that path has changed in Dst, and reports whether
+// m's policy is to leave it alone. If so, m records the file's
+// revision, so the next change overwrites it unless Dst changes again.
+func (m *Mirror) conflict(path string) (skip bool, err error) {
+	if m.Log != nil {
+		m.Log.Printf("mirror: %s changed in destination", path)
+	} else {
+		log.Printf("mirror: %s changed in destination", path)
+	}
+	if m.Policy != Skip {
+		return false, nil
+	}
+	_, rev, err := m.Dst.Stat(path, nil)
+	if isErr(err, ErrNoEnt) {
+		rev, err = missing, nil
+	}
+	m.revs[path] = rev
+	return true, err
+}
+
+// Rev returns the last revision of Src that m has mirrored.
+func (m *Mirror) Rev() int64 {
+	return atomic.LoadInt64(&m.rev)
+}
+
+// Run copies Src to Dst and then follows Src until an error occurs,
+// which it returns. To carry on after reconnecting, set From to Rev
+// and call Run again.
+func (m *Mirror) Run() error {
+	m.revs = make(map[string]int64)
+
+	rev := m.From
+	if rev == 0 {
+		var err error
+		rev, err = m.copy()
+		if err != nil {
+			return err
+		}
+	}
+	atomic.StoreInt64(&m.rev, rev)
+
+	for {
+		ev, err := m.Src.Wait(m.Glob, rev+1)
+		if err != nil {
+			return err
+		}
+
+		err = m.apply(ev, rev)
+		if err != nil {
+			return err
+		}
+
+		rev = ev.Rev
+		atomic.StoreInt64(&m.rev, rev)
+	}
+}
+
+// copy writes every matching file in Src to Dst
+// and returns the revision it copied.
+func (m *Mirror) copy() (int64, error) {
+	rev, err := m.Src.Rev()
+	if err != nil {
+		return 0, err
+	}
+
+	evs, err := m.Src.Walk(m.Glob, rev, 0, -1)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, ev := range evs {
+		path := m.Prefix + ev.Path
+		m.revs[path], err = m.Dst.Set(path, clobber, ev.Body)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return rev, nil
+}
+
+// apply writes ev to Dst. prev is the last revision mirrored.
+func (m *Mirror) apply(ev Event, prev int64) error {
+	path := m.Prefix + ev.Path
+	oldRev, ok, err := m.dstRev(path, ev.Path, prev)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case ev.IsSet():
+		var rev int64
+		if ok {
+			rev, err = m.Dst.Set(path, oldRev, ev.Body)
+		}
+		if !ok || IsConflict(err) {
+			var skip bool
+			if skip, err = m.conflict(path); skip || err != nil {
+				return err
+			}
+			rev, err = m.Dst.Set(path, clobber, ev.Body)
+		}
+		if err != nil {
+			return err
+		}
+		m.revs[path] = rev
+	case ev.IsDel():
+		if ok {
+			err = m.Dst.Del(path, oldRev)
+		}
+		if !ok || IsConflict(err) {
+			var skip bool
+			if skip, err = m.conflict(path); skip || err != nil {
+				return err
+			}
+			err = m.Dst.Del(path, clobber)
+		}
+		if err != nil && !isErr(err, ErrNoEnt) {
+			return err
+		}
+		delete(m.revs, path)
+	}
+	return nil
+}
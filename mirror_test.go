@@ -0,0 +1,163 @@
+package doozer
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"testing"
+)
+
+// runMirror starts m and returns a function that stops it
+// by closing src, returning Run's error.
+func runMirror(m *Mirror, src *Conn) (stop func() error) {
+	errc := make(chan error, 1)
+	go func() { errc <- m.Run() }()
+	return func() error {
+		src.Close()
+		return <-errc
+	}
+}
+
+// waitBody waits for file in c to hold body.
+func waitBody(t *testing.T, c *Conn, file, body string) {
+	if !settle(func() bool {
+		b, _, _ := c.Get(file, nil)
+		return string(b) == body
+	}) {
+		b, _, _ := c.Get(file, nil)
+		t.Fatalf("%s: got %q, want %q", file, b, body)
+	}
+}
+
+// captureLog sends the log to a buffer until t ends.
+func captureLog(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return &buf
+}
+
+func TestMirrorResume(t *testing.T) {
+	logs := captureLog(t)
+	ss, ds := newServer(t), newServer(t)
+	src, dst := dialServer(t, ss), dialServer(t, ds)
+
+	_, err := src.Set("/a", clobber, []byte("1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &Mirror{Src: src, Dst: dst, Glob: "/**"}
+	stop := runMirror(m, src)
+	waitBody(t, dst, "/a", "1")
+	stop()
+
+	src = dialServer(t, ss)
+	_, err = src.Set("/a", clobber, []byte("2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m = &Mirror{Src: src, Dst: dst, Glob: "/**", From: m.Rev()}
+	stop = runMirror(m, src)
+	waitBody(t, dst, "/a", "2")
+	stop()
+
+	if logs.Len() > 0 {
+		t.Fatalf("unexpected log output: %s", logs)
+	}
+}
+
+func TestMirrorSkipOnce(t *testing.T) {
+	logs := captureLog(t)
+	ss, ds := newServer(t), newServer(t)
+	src, dst := dialServer(t, ss), dialServer(t, ds)
+
+	_, err := src.Set("/a", clobber, []byte("1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &Mirror{Src: src, Dst: dst, Glob: "/**", Policy: Skip}
+	stop := runMirror(m, src)
+	defer stop()
+	waitBody(t, dst, "/a", "1")
+
+	_, err = dst.Set("/a", clobber, []byte("local"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = src.Set("/a", clobber, []byte("2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !settle(func() bool { return m.Rev() == src.LastRev() }) {
+		t.Fatal("mirror fell behind")
+	}
+	waitBody(t, dst, "/a", "local")
+	if !bytes.Contains(logs.Bytes(), []byte("/a changed in destination")) {
+		t.Fatalf("conflict not logged: %q", logs)
+	}
+
+	_, err = src.Set("/a", clobber, []byte("3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitBody(t, dst, "/a", "3")
+}
+
+// TestMirrorResumeConflict changes one file in Dst, and deletes
+// another, while no Mirror runs. The next Mirror, resuming, must
+// see both as conflicts.
+func TestMirrorResumeConflict(t *testing.T) {
+	for _, policy := range []int{Overwrite, Skip} {
+		stdlog := captureLog(t)
+		ss, ds := newServer(t), newServer(t)
+		src, dst := dialServer(t, ss), dialServer(t, ds)
+
+		for _, p := range []string{"/a", "/b", "/c"} {
+			if _, err := src.Set(p, clobber, []byte("1")); err != nil {
+				t.Fatal(err)
+			}
+		}
+		m := &Mirror{Src: src, Dst: dst, Glob: "/**"}
+		stop := runMirror(m, src)
+		waitBody(t, dst, "/c", "1")
+		stop()
+
+		if _, err := dst.Set("/a", clobber, []byte("local")); err != nil {
+			t.Fatal(err)
+		}
+		if err := dst.Del("/c", clobber); err != nil {
+			t.Fatal(err)
+		}
+		src = dialServer(t, ss)
+		for _, p := range []string{"/a", "/b", "/c"} {
+			if _, err := src.Set(p, clobber, []byte("2")); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var logs bytes.Buffer
+		m = &Mirror{Src: src, Dst: dst, Glob: "/**", From: m.Rev(), Policy: policy}
+		m.Log = log.New(&logs, "", 0)
+		stop = runMirror(m, src)
+		if !settle(func() bool { return m.Rev() == src.LastRev() }) {
+			t.Fatal("mirror fell behind")
+		}
+		stop()
+
+		// /b is unchanged in Dst, so it is updated quietly.
+		waitBody(t, dst, "/b", "2")
+		if logs.String() != "mirror: /a changed in destination\nmirror: /c changed in destination\n" {
+			t.Fatalf("policy %d: log: %q", policy, logs.String())
+		}
+		if stdlog.Len() > 0 {
+			t.Fatalf("policy %d: standard log used: %q", policy, stdlog)
+		}
+		if policy == Skip {
+			waitBody(t, dst, "/a", "local")
+			waitBody(t, dst, "/c", "")
+		} else {
+			waitBody(t, dst, "/a", "2")
+			waitBody(t, dst, "/c", "2")
+		}
+	}
+}
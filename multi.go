@@ -0,0 +1,136 @@
+package doozer
+
+import (
+	"sync"
+)
+
+// defaultMultiWindow is the default value of Conn.MultiWindow.
+const defaultMultiWindow = 64
+
+// A Result holds the outcome of reading one path in GetMulti.
+type Result struct {
+	Path string
+	Body []byte
+	Rev  int64
+	Err  error
+}
+
+// GetMulti reads the body and revision of each file in paths,
+// as of store revision *rev, without waiting for one response
+// before sending the next request.
+// If rev is nil, uses the current state.
+// Results are in the same order as paths. An error reported by the
+// store for one path, such as ErrNoEnt, is recorded in its Result,
+// as is ErrBusy if c.FailFast turns the request away;
+// GetMulti itself fails only if the connection does.
+func (c *Conn) GetMulti(paths []string, rev *int64) ([]Result, error) {
+	rev, err := c.readRev(rev)
+	if err != nil {
+		return nil, err
+	}
+
+	ts := make([]txn, len(paths))
+	for i := range ts {
+		ts[i].req.Verb = request_GET.Enum()
+		ts[i].req.Path = &paths[i]
+		ts[i].req.Rev = rev
+	}
+
+	errs, err := c.callMulti(ts)
+	if err != nil {
+		return nil, err
+	}
+
+	rs := make([]Result, len(paths))
+	for i := range rs {
+		rs[i].Path = paths[i]
+		rs[i].Err = errs[i]
+		if errs[i] == nil {
+			rs[i].Body, rs[i].Err = c.decode(ts[i].resp.Value)
+			rs[i].Rev = ts[i].resp.GetRev()
+			if rs[i].Rev > 0 {
+				rs[i].Body = nonNil(rs[i].Body)
+			}
+		}
+	}
+	return rs, nil
+}
+
+// A SetOp describes one write in SetMulti.
+type SetOp struct {
+	Path   string
+	OldRev int64
+	Body   []byte
+}
+
+// A SetResult holds the outcome of one SetOp in SetMulti.
+type SetResult struct {
+	Path string
+	Rev  int64
+	Err  error
+}
+
+// SetMulti performs each of ops as if by Set, without waiting for one
+// response before sending the next request.
+// SetMulti is not a transaction: each op succeeds or fails on its own,
+// in no particular order, and other clients may see some of the writes
+// before others are applied.
+// Results are in the same order as ops. An error reported by the
+// store for one op, such as ErrOldRev, is recorded in its SetResult
+// and does not stop the others, as is ErrBusy if c.FailFast turns
+// the request away; SetMulti itself fails only if the connection does.
+func (c *Conn) SetMulti(ops []SetOp) ([]SetResult, error) {
+	ts := make([]txn, len(ops))
+	for i := range ts {
+		ts[i].req.Verb = request_SET.Enum()
+		ts[i].req.Path = &ops[i].Path
+		ts[i].req.Value = c.encode(ops[i].Body)
+		ts[i].req.Rev = &ops[i].OldRev
+	}
+
+	errs, err := c.callMulti(ts)
+	if err != nil {
+		return nil, err
+	}
+
+	rs := make([]SetResult, len(ops))
+	for i := range rs {
+		rs[i].Path = ops[i].Path
+		rs[i].Err = errs[i]
+		if errs[i] == nil {
+			rs[i].Rev = ts[i].resp.GetRev()
+		}
+	}
+	return rs, nil
+}
+
+// callMulti calls each txn in ts, keeping up to c.MultiWindow in flight.
+// It returns the error for each txn that failed on its own, from
+// the store or ErrBusy, or else the first error of the connection.
+func (c *Conn) callMulti(ts []txn) ([]error, error) {
+	n := c.MultiWindow
+	if n <= 0 {
+		n = defaultMultiWindow
+	}
+
+	errs := make([]error, len(ts))
+	sem := make(chan bool, n)
+	var wg sync.WaitGroup
+	for i := range ts {
+		sem <- true
+		wg.Add(1)
+		go func(i int) {
+			errs[i] = c.call(&ts[i])
+			<-sem
+			wg.Done()
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if _, ok := err.(*Error); err != nil && !ok && err != ErrBusy {
+			return nil, err
+		}
+	}
+	return errs, nil
+}
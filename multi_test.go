@@ -0,0 +1,164 @@
+package doozer
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ha/doozer/doozertest"
+)
+
+// setFiles writes n files under dir, named 0 to n-1.
+func setFiles(t testing.TB, c *Conn, dir string, n int) []string {
+	ops := make([]SetOp, n)
+	paths := make([]string, n)
+	for i := range ops {
+		paths[i] = fmt.Sprintf("%s/%d", dir, i)
+		ops[i] = SetOp{Path: paths[i], OldRev: clobber, Body: []byte(paths[i])}
+	}
+	rs, err := c.SetMulti(ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range rs {
+		if r.Err != nil {
+			t.Fatal(r.Err)
+		}
+	}
+	return paths
+}
+
+func TestGetMulti(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+
+	paths := append(setFiles(t, c, "/m", 200), "/m/none", "/m")
+	rs, err := c.GetMulti(paths, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, r := range rs[:200] {
+		if r.Err != nil || r.Path != paths[i] || string(r.Body) != paths[i] || r.Rev <= 0 {
+			t.Fatalf("%d: %+v", i, r)
+		}
+	}
+	if r := rs[200]; r.Err != nil || r.Body != nil || r.Rev != missing {
+		t.Fatalf("missing file: %+v", r)
+	}
+	if r := rs[201]; !isErr(r.Err, ErrIsDir) {
+		t.Fatalf("dir: %+v, want ErrIsDir", r)
+	}
+}
+
+func TestMultiBusy(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+	paths := setFiles(t, c, "/m", 200)
+
+	c.MaxInFlight = 1
+	c.FailFast = true
+	rs, err := c.GetMulti(paths, nil)
+	if err != nil {
+		t.Fatalf("GetMulti: %v, want ErrBusy per item", err)
+	}
+	for i, r := range rs {
+		if r.Err != nil && r.Err != ErrBusy {
+			t.Fatalf("%d: %v", i, r.Err)
+		}
+		if r.Err == nil && string(r.Body) != paths[i] {
+			t.Fatalf("%d: %q", i, r.Body)
+		}
+	}
+
+	ops := make([]SetOp, len(paths))
+	for i := range ops {
+		ops[i] = SetOp{Path: paths[i], OldRev: clobber}
+	}
+	srs, err := c.SetMulti(ops)
+	if err != nil {
+		t.Fatalf("SetMulti: %v, want ErrBusy per item", err)
+	}
+	for i, r := range srs {
+		if r.Err != nil && r.Err != ErrBusy {
+			t.Fatalf("%d: %v", i, r.Err)
+		}
+	}
+}
+
+func BenchmarkGetMulti(b *testing.B) {
+	s := newServer(b)
+	c := dialServer(b, s)
+	paths := setFiles(b, c, "/m", 200)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := c.GetMulti(paths, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGetSequential(b *testing.B) {
+	s := newServer(b)
+	c := dialServer(b, s)
+	paths := setFiles(b, c, "/m", 200)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, p := range paths {
+			if _, _, err := c.Get(p, nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// peakMulti sets n files with c's SetMulti, and returns the most
+// requests c had in flight at once.
+func peakMulti(t *testing.T, c *Conn, dir string, n int) int {
+	var mu sync.Mutex
+	var live, peak int
+	c.Trace = &Trace{
+		RequestSent: func(string, string, int32, string) {
+			mu.Lock()
+			if live++; live > peak {
+				peak = live
+			}
+			mu.Unlock()
+		},
+		ResponseReceived: func(int32, error, time.Duration) {
+			mu.Lock()
+			live--
+			mu.Unlock()
+		},
+	}
+	setFiles(t, c, dir, n)
+	mu.Lock()
+	defer mu.Unlock()
+	return peak
+}
+
+// TestMultiWindow checks that each Conn keeps to its own window.
+func TestMultiWindow(t *testing.T) {
+	s, err := doozertest.NewUnstartedServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.Delay = time.Millisecond
+	s.Start()
+
+	narrow := dialServer(t, s)
+	narrow.MultiWindow = 3
+	wide := dialServer(t, s)
+
+	if p := peakMulti(t, narrow, "/narrow", 100); p != 3 {
+		t.Errorf("peak in flight with MultiWindow 3: %d", p)
+	}
+	if p := peakMulti(t, wide, "/wide", 200); p <= 3 || p > defaultMultiWindow {
+		t.Errorf("peak in flight with the default window: %d, want at most %d", p, defaultMultiWindow)
+	}
+}
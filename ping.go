@@ -0,0 +1,84 @@
+package doozer
+
+import (
+	"sync"
+	"time"
+)
+
+// pingWindow is how many addresses PingAddrs probes at once.
+const pingWindow = 8
+
+// A PingResult is the outcome of pinging one address.
+type PingResult struct {
+	Addr string
+	RTT  time.Duration // round trip time of a Nop, if Err is nil
+	Err  error
+}
+
+// Ping measures the round trip time of a Nop to each node listed
+// in /ctl/node, as PingAddrs does. It leaves c itself undisturbed.
+func (c *Conn) Ping(timeout time.Duration) ([]PingResult, error) {
+	nodes, err := c.Nodes(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var addrs []string
+	for _, n := range nodes {
+		if n.Addr != "" {
+			addrs = append(addrs, n.Addr)
+		}
+	}
+	return PingAddrs(addrs, timeout), nil
+}
+
+// PingAddrs dials each of addrs on a new connection, sends a Nop,
+// and measures the round trip time. The dial and the Nop must each
+// finish within timeout, if it is positive. Results are in the same
+// order as addrs; an address that could not be reached has Err set.
+func PingAddrs(addrs []string, timeout time.Duration) []PingResult {
+	rs := make([]PingResult, len(addrs))
+	sem := make(chan bool, pingWindow)
+	var wg sync.WaitGroup
+	for i := range rs {
+		rs[i].Addr = addrs[i]
+		sem <- true
+		wg.Add(1)
+		go func(r *PingResult) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			r.RTT, r.Err = ping(r.Addr, timeout)
+		}(&rs[i])
+	}
+	wg.Wait()
+	return rs
+}
+
+func ping(addr string, timeout time.Duration) (time.Duration, error) {
+	c, err := dial(addr, timeout)
+	if err != nil {
+		return 0, err
+	}
+	defer c.Close()
+
+	start := time.Now()
+	ch := make(chan error, 1)
+	go func() {
+		ch <- c.Nop()
+	}()
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case err = <-ch:
+		return time.Since(start), err
+	case <-expired:
+		return 0, ErrWaitTimeout
+	}
+}
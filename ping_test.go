@@ -0,0 +1,124 @@
+package doozer
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+)
+
+// silentListener returns a listener that accepts connections
+// and never answers.
+func silentListener(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			nc, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(ioutil.Discard, nc) // until the client hangs up
+				nc.Close()
+			}()
+		}
+	}()
+	return l
+}
+
+// deadAddr returns an address with nothing listening on it.
+func deadAddr(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	return addr
+}
+
+func TestPingAddrs(t *testing.T) {
+	a, b := newServer(t), newServer(t)
+	silent := silentListener(t)
+	addrs := []string{a.Addr, deadAddr(t), b.Addr, silent.Addr().String()}
+
+	rs := PingAddrs(addrs, 100*time.Millisecond)
+	if len(rs) != len(addrs) {
+		t.Fatalf("%d results for %d addresses", len(rs), len(addrs))
+	}
+	for i, r := range rs {
+		if r.Addr != addrs[i] {
+			t.Errorf("result %d is for %s, want %s", i, r.Addr, addrs[i])
+		}
+	}
+	for _, i := range []int{0, 2} {
+		if rs[i].Err != nil || rs[i].RTT <= 0 {
+			t.Errorf("live %s: %v %v", rs[i].Addr, rs[i].RTT, rs[i].Err)
+		}
+	}
+	if rs[1].Err == nil {
+		t.Errorf("dead address: %v, want an error", rs[1].RTT)
+	}
+	if rs[3].Err != ErrWaitTimeout {
+		t.Errorf("silent server: %v, want ErrWaitTimeout", rs[3].Err)
+	}
+}
+
+// TestPingAddrsWindow pings many silent servers. With at most
+// pingWindow probes at once, each timing out, it takes three rounds.
+func TestPingAddrsWindow(t *testing.T) {
+	silent := silentListener(t)
+	addrs := make([]string, 3*pingWindow)
+	for i := range addrs {
+		addrs[i] = silent.Addr().String()
+	}
+	const timeout = 20 * time.Millisecond
+	start := time.Now()
+	for _, r := range PingAddrs(addrs, timeout) {
+		if r.Err != ErrWaitTimeout {
+			t.Fatalf("%s: %v, want ErrWaitTimeout", r.Addr, r.Err)
+		}
+	}
+	if d := time.Since(start); d < 3*timeout {
+		t.Fatalf("took %v, want at least %v", d, 3*timeout)
+	}
+}
+
+func TestPing(t *testing.T) {
+	s, node := newServer(t), newServer(t)
+	c := dialServer(t, s)
+	dead := deadAddr(t)
+	for path, body := range map[string]string{
+		"/ctl/node/x/addr":     node.Addr,
+		"/ctl/node/y/addr":     dead,
+		"/ctl/node/z/hostname": "no address",
+	} {
+		if _, err := c.Set(path, clobber, []byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rs, err := c.Ping(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs) != 2 || rs[0].Addr != node.Addr || rs[1].Addr != dead {
+		t.Fatalf("Ping: %+v, want x and y", rs)
+	}
+	if rs[0].Err != nil || rs[1].Err == nil {
+		t.Fatalf("Ping: %+v", rs)
+	}
+
+	// The probes use their own connections.
+	if n := c.Stats().Requests["NOP"]; n != 0 {
+		t.Fatalf("NOP requests on c: %d", n)
+	}
+	if _, err := c.Rev(); err != nil {
+		t.Fatalf("c after Ping: %v", err)
+	}
+}
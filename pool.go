@@ -0,0 +1,80 @@
+package doozer
+
+import (
+	"sync/atomic"
+)
+
+// A Pool is a set of connections that share the request load.
+// Each request made through Pool.Conn goes to the live connection
+// with the fewest requests in flight.
+type Pool struct {
+	conns []*Conn
+}
+
+// DialPool opens n connections to the doozer server at addr.
+func DialPool(addr string, n int) (*Pool, error) {
+	return dialPool(n, func() (*Conn, error) {
+		return Dial(addr)
+	})
+}
+
+// DialUriPool opens n connections as if by DialUri.
+// Each connection is authenticated separately.
+func DialUriPool(uri, buri string, n int) (*Pool, error) {
+	return dialPool(n, func() (*Conn, error) {
+		return DialUri(uri, buri)
+	})
+}
+
+func dialPool(n int, dial func() (*Conn, error)) (*Pool, error) {
+	if n < 1 {
+		n = 1
+	}
+
+	p := new(Pool)
+	for i := 0; i < n; i++ {
+		c, err := dial()
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+		p.conns = append(p.conns, c)
+	}
+	return p, nil
+}
+
+// Conn returns the live connection with the fewest requests in flight,
+// or, if none is live, the first one, whose operations will return
+// its error.
+// Operations that span several requests, such as a Watch, should keep
+// using the Conn they started on.
+func (p *Pool) Conn() *Conn {
+	var best *Conn
+	var min int32
+	for _, c := range p.conns {
+		if c.isStopped() {
+			continue
+		}
+		n := atomic.LoadInt32(&c.inflight)
+		if best == nil || n < min {
+			best, min = c, n
+		}
+	}
+	if best == nil {
+		return p.conns[0]
+	}
+	return best
+}
+
+// Conns returns the connections in p, for setting options
+// such as MaxInFlight on each.
+func (p *Pool) Conns() []*Conn {
+	return p.conns
+}
+
+// Close closes every connection in p.
+func (p *Pool) Close() {
+	for _, c := range p.conns {
+		c.Close()
+	}
+}
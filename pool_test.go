@@ -0,0 +1,89 @@
+package doozer
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/ha/doozer/doozertest"
+)
+
+// newPool returns a Pool of n connections to s, closed when t ends.
+func newPool(t testing.TB, s *doozertest.Server, n int) *Pool {
+	p, err := DialPool(s.Addr, n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(p.Close)
+	return p
+}
+
+func TestPoolSpreadsLoad(t *testing.T) {
+	s := newServer(t)
+	p := newPool(t, s, 4)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				p.Conn().Set(fmt.Sprintf("/p/%d", i), clobber, []byte("x"))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i, c := range p.conns {
+		if c.Stats().Requests["SET"] == 0 {
+			t.Errorf("conn %d sent no requests", i)
+		}
+	}
+}
+
+func TestPoolSkipsDeadConns(t *testing.T) {
+	s := newServer(t)
+	p := newPool(t, s, 3)
+
+	p.conns[0].Close()
+	p.conns[2].Close()
+	settle(func() bool { return p.conns[0].isStopped() && p.conns[2].isStopped() })
+	for i := 0; i < 10; i++ {
+		if c := p.Conn(); c != p.conns[1] {
+			t.Fatal("Conn returned a closed connection")
+		}
+	}
+	if _, err := p.Conn().Rev(); err != nil {
+		t.Fatal(err)
+	}
+
+	p.conns[1].Close()
+	settle(p.conns[1].isStopped)
+	if _, err := p.Conn().Rev(); err != ErrClosed {
+		t.Fatalf("Rev with every conn closed: got %v, want ErrClosed", err)
+	}
+}
+
+func benchmarkPool(b *testing.B, n int) {
+	s := newServer(b)
+	p := newPool(b, s, n)
+	if _, err := p.Conn().Set("/b", clobber, []byte("body")); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.SetParallelism(16)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, _, err := p.Conn().Get("/b", nil); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+func BenchmarkPool1(b *testing.B) { benchmarkPool(b, 1) }
+func BenchmarkPool2(b *testing.B) { benchmarkPool(b, 2) }
+func BenchmarkPool4(b *testing.B) { benchmarkPool(b, 4) }
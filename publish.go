@@ -0,0 +1,116 @@
+package doozer
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PublishOptions control how PublishAndWait waits for acks.
+type PublishOptions struct {
+	// Timeout is how long to wait for every member to ack.
+	// Zero means to wait forever.
+	Timeout time.Duration
+
+	// Live makes members that join or leave during the wait
+	// count, or stop counting. Otherwise the members are those
+	// present when the body is published.
+	Live bool
+}
+
+// PublishAndWait sets file to body, then waits until each member
+// has acked the new revision, and returns it.
+//
+// Members are the files matching the glob members, and acks the
+// files matching the glob acks; both are known by their base names.
+// So with members "/nodes/*" and acks "/acks/*", node "/nodes/a"
+// acks by writing the revision, in decimal, to "/acks/a". A later
+// revision acks too.
+//
+// If the timeout expires, PublishAndWait returns the revision,
+// the members yet to ack, sorted, and ErrWaitTimeout.
+func (c *Conn) PublishAndWait(file string, body []byte, members, acks string, opt PublishOptions) (int64, []string, error) {
+	memberRe, err := compileGlob(members)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	rev, err := c.Set(file, clobber, body)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	evs, err := c.Walk(members, rev, 0, -1)
+	if err != nil {
+		return rev, nil, err
+	}
+	waiting := make(map[string]bool)
+	for _, ev := range evs {
+		waiting[ev.Name] = true
+	}
+
+	acked := make(map[string]bool)
+	ack := func(ev *Event) {
+		n, err := strconv.ParseInt(strings.TrimSpace(string(ev.Body)), 10, 64)
+		if ev.IsSet() && err == nil && n >= rev {
+			acked[ev.Name] = true
+			delete(waiting, ev.Name)
+		}
+	}
+
+	evs, err = c.Walk(acks, rev, 0, -1)
+	if err != nil {
+		return rev, nil, err
+	}
+	for i := range evs {
+		evs[i].Flag = set
+		ack(&evs[i])
+	}
+
+	globs := []string{acks}
+	if opt.Live {
+		globs = append(globs, members)
+	}
+	w, err := c.WatchAll(globs, rev+1)
+	if err != nil {
+		return rev, nil, err
+	}
+	defer w.Cancel()
+
+	if opt.Timeout > 0 {
+		t := time.AfterFunc(opt.Timeout, w.Cancel)
+		defer t.Stop()
+	}
+
+	for len(waiting) > 0 {
+		ev, err := w.Next()
+		if w.Err() == ErrCancelled {
+			return rev, sortedKeys(waiting), ErrWaitTimeout
+		}
+		if err != nil {
+			return rev, nil, err
+		}
+
+		switch {
+		case opt.Live && memberRe.MatchString(ev.Path):
+			if ev.IsDel() {
+				delete(waiting, ev.Name)
+			} else if !acked[ev.Name] {
+				waiting[ev.Name] = true
+			}
+		default:
+			ack(ev)
+		}
+	}
+	return rev, nil, nil
+}
+
+func sortedKeys(m map[string]bool) []string {
+	var a []string
+	for k := range m {
+		a = append(a, k)
+	}
+	sort.Strings(a)
+	return a
+}
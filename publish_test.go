@@ -0,0 +1,131 @@
+package doozer
+
+import (
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// published waits on c for the next set of file after from,
+// and returns its rev.
+func published(t *testing.T, c *Conn, file string, from int64) int64 {
+	ev, err := c.Wait(file, from+1)
+	if err != nil {
+		t.Error(err)
+		return 0
+	}
+	return ev.Rev
+}
+
+func ackRev(t *testing.T, c *Conn, name string, rev int64) {
+	if _, err := c.Set("/acks/"+name, clobber, []byte(strconv.FormatInt(rev, 10))); err != nil {
+		t.Error(err)
+	}
+}
+
+func setMembers(t *testing.T, c *Conn, names ...string) int64 {
+	var rev int64
+	for _, name := range names {
+		var err error
+		rev, err = c.Set("/nodes/"+name, clobber, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rev
+}
+
+func TestPublishAndWait(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+	from := setMembers(t, c, "a", "b", "c")
+
+	// Each member acks from its own Conn once it sees the body.
+	for _, name := range []string{"a", "b", "c"} {
+		m := dialServer(t, s)
+		go func(name string) {
+			if rev := published(t, m, "/cfg", from); rev > 0 {
+				ackRev(t, m, name, rev)
+			}
+		}(name)
+	}
+
+	opt := PublishOptions{Timeout: 5 * time.Second}
+	rev, missing, err := c.PublishAndWait("/cfg", []byte("v1"), "/nodes/*", "/acks/*", opt)
+	if err != nil || len(missing) != 0 {
+		t.Fatalf("PublishAndWait: %v %v", missing, err)
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		body, _, err := c.Get("/acks/"+name, nil)
+		if err != nil || string(body) != strconv.FormatInt(rev, 10) {
+			t.Fatalf("ack of %s: %q %v, want %d", name, body, err, rev)
+		}
+	}
+}
+
+func TestPublishAndWaitTimeout(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+	from := setMembers(t, c, "a", "b", "c")
+
+	// a acks; b acks a revision from before the publish; c never acks.
+	ackRev(t, c, "b", from)
+	m := dialServer(t, s)
+	go func() {
+		if rev := published(t, m, "/cfg", from+1); rev > 0 {
+			ackRev(t, m, "a", rev)
+		}
+	}()
+
+	opt := PublishOptions{Timeout: 100 * time.Millisecond}
+	_, missing, err := c.PublishAndWait("/cfg", nil, "/nodes/*", "/acks/*", opt)
+	if err != ErrWaitTimeout {
+		t.Fatalf("PublishAndWait: %v, want ErrWaitTimeout", err)
+	}
+	if len(missing) != 2 || missing[0] != "b" || missing[1] != "c" {
+		t.Fatalf("missing: %q, want [b c]", missing)
+	}
+}
+
+// TestPublishAndWaitLive has c join and b leave during the wait.
+// With Live, c must ack and b need not; without it, the reverse.
+func TestPublishAndWaitLive(t *testing.T) {
+	for _, live := range []bool{true, false} {
+		s := newServer(t)
+		c := dialServer(t, s)
+		from := setMembers(t, c, "a", "b")
+
+		m := dialServer(t, s)
+		var cAcked int32
+		go func() {
+			rev := published(t, m, "/cfg", from)
+			if rev == 0 {
+				return
+			}
+			setMembers(t, m, "c")
+			if err := m.Del("/nodes/b", clobber); err != nil {
+				t.Error(err)
+			}
+			ackRev(t, m, "a", rev)
+
+			// Were c not counted, the wait would end here.
+			time.Sleep(50 * time.Millisecond)
+			atomic.StoreInt32(&cAcked, 1)
+			ackRev(t, m, "c", rev)
+		}()
+
+		opt := PublishOptions{Timeout: 500 * time.Millisecond, Live: live}
+		_, missing, err := c.PublishAndWait("/cfg", nil, "/nodes/*", "/acks/*", opt)
+		if live {
+			if err != nil {
+				t.Fatalf("Live: %v %v", missing, err)
+			}
+			if atomic.LoadInt32(&cAcked) == 0 {
+				t.Fatal("Live: returned before the member that joined acked")
+			}
+		} else if err != ErrWaitTimeout || len(missing) != 1 || missing[0] != "b" {
+			t.Fatalf("not Live: %q %v, want [b] and ErrWaitTimeout", missing, err)
+		}
+	}
+}
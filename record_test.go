@@ -0,0 +1,121 @@
+package doozer
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"net"
+	"testing"
+
+	"github.com/ha/doozer/doozertest"
+)
+
+var record = flag.Bool("record", false, "rewrite testdata/session.rec from doozertest")
+
+const sessionFile = "testdata/session.rec"
+
+// session makes a fixed sequence of calls on c and checks the
+// results. Its requests must not depend on anything but the
+// responses, so a recording of it can be replayed.
+func session(t *testing.T, c *Conn) {
+	rev, err := c.Set("/cfg/a", 0, []byte("one"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.Set("/cfg/a", 0, []byte("two"))
+	if !IsConflict(err) {
+		t.Fatalf("Set at an old rev: got %v, want a conflict", err)
+	}
+	_, err = c.Set("/cfg/b", clobber, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, frev, err := c.Get("/cfg/a", &rev)
+	if err != nil || string(body) != "one" || frev != rev {
+		t.Fatalf("Get: %q %d %v", body, frev, err)
+	}
+
+	cur, err := c.Rev()
+	if err != nil {
+		t.Fatal(err)
+	}
+	names, err := c.Getdir("/cfg", cur, 0, -1)
+	if err != nil || len(names) != 2 || names[0] != "a" {
+		t.Fatalf("Getdir: %v %v", names, err)
+	}
+	evs, err := c.Walk("/cfg/*", cur, 0, -1)
+	if err != nil || len(evs) != 2 || evs[1].Path != "/cfg/b" {
+		t.Fatalf("Walk: %v %v", evs, err)
+	}
+	n, frev, err := c.Stat("/cfg/a", &cur)
+	if err != nil || n != 3 || frev != rev {
+		t.Fatalf("Stat: %d %d %v", n, frev, err)
+	}
+	ev, err := c.Wait("/cfg/**", rev)
+	if err != nil || ev.Path != "/cfg/a" || string(ev.Body) != "one" {
+		t.Fatalf("Wait: %+v %v", ev, err)
+	}
+
+	err = c.Del("/cfg/a", clobber)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = c.Get("/cfg", nil)
+	if !isErr(err, ErrIsDir) {
+		t.Fatalf("Get of a dir: got %v, want ErrIsDir", err)
+	}
+	if err := c.Nop(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestRecord rewrites the recording, with -record.
+func TestRecord(t *testing.T) {
+	if !*record {
+		t.Skip("run with -record to rewrite " + sessionFile)
+	}
+
+	s, err := doozertest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	nc, err := net.Dial("tcp", s.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var log bytes.Buffer
+	r := doozertest.NewRecorder(nc, &log)
+	c := NewConn(r)
+	session(t, c)
+	c.Close()
+	if err := r.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	err = ioutil.WriteFile(sessionFile, log.Bytes(), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	if *record {
+		t.Skip("recording")
+	}
+
+	log, err := ioutil.ReadFile(sessionFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nc, errc := doozertest.Replay(bytes.NewReader(log))
+	c := NewConn(nc)
+	defer c.Close()
+
+	session(t, c)
+	if err := <-errc; err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package doozer
+
+import (
+	"sync/atomic"
+)
+
+// Stats holds counters describing the traffic on a Conn.
+type Stats struct {
+	Requests     map[string]int64 // calls made, by verb
+	Errors       map[string]int64 // calls that returned an error, by verb
+	BytesRead    int64
+	BytesWritten int64
+	InFlight     int   // calls waiting for a response
+	Queued       int   // calls waiting for a MaxInFlight slot
+	Watches      int   // calls to Wait waiting for an event
+	LastErr      error // the last error returned by any call
+}
+
+type verbCount struct {
+	reqs int64 // accessed atomically
+	errs int64 // accessed atomically
+}
+
+func newVerbCounts() map[request_Verb]*verbCount {
+	m := make(map[request_Verb]*verbCount)
+	for v := range request_Verb_name {
+		m[request_Verb(v)] = new(verbCount)
+	}
+	return m
+}
+
+// Stats returns a snapshot of c's counters.
+func (c *Conn) Stats() Stats {
+	s := Stats{
+		Requests:     make(map[string]int64),
+		Errors:       make(map[string]int64),
+		BytesRead:    atomic.LoadInt64(&c.nread),
+		BytesWritten: atomic.LoadInt64(&c.nwritten),
+		InFlight:     int(atomic.LoadInt32(&c.inflight)),
+		Watches:      int(atomic.LoadInt32(&c.watches)),
+		Queued:       int(atomic.LoadInt32(&c.queued)),
+	}
+	for v, n := range c.verbs {
+		if r := atomic.LoadInt64(&n.reqs); r > 0 {
+			s.Requests[v.String()] = r
+		}
+		if e := atomic.LoadInt64(&n.errs); e > 0 {
+			s.Errors[v.String()] = e
+		}
+	}
+	c.errmu.Lock()
+	s.LastErr = c.lastErr
+	c.errmu.Unlock()
+	return s
+}
+
+// count records the outcome of a call of t.
+func (c *Conn) count(t *txn, err error) {
+	n := c.verbs[t.req.GetVerb()]
+	if n == nil {
+		return
+	}
+	atomic.AddInt64(&n.reqs, 1)
+	if err != nil {
+		atomic.AddInt64(&n.errs, 1)
+		c.errmu.Lock()
+		c.lastErr = err
+		c.errmu.Unlock()
+	}
+}
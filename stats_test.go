@@ -0,0 +1,76 @@
+package doozer
+
+import (
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+
+	st := c.Stats()
+	if len(st.Requests) != 0 || len(st.Errors) != 0 || st.LastErr != nil {
+		t.Fatalf("fresh Conn: %+v", st)
+	}
+
+	rev, err := c.Set("/s", 0, []byte("body"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Get("/s", nil)
+	c.Get("/s", nil)
+	_, err = c.Set("/s", 0, []byte("again"))
+	if !IsConflict(err) {
+		t.Fatalf("got %v, want a conflict", err)
+	}
+
+	st = c.Stats()
+	if st.Requests["SET"] != 2 || st.Requests["GET"] != 2 {
+		t.Fatalf("Requests: %v", st.Requests)
+	}
+	if st.Errors["SET"] != 1 || st.Errors["GET"] != 0 {
+		t.Fatalf("Errors: %v", st.Errors)
+	}
+	if st.LastErr != err {
+		t.Fatalf("LastErr: %v, want %v", st.LastErr, err)
+	}
+	if st.BytesRead == 0 || st.BytesWritten == 0 {
+		t.Fatalf("bytes: %d read, %d written", st.BytesRead, st.BytesWritten)
+	}
+	if st.InFlight != 0 || st.Watches != 0 || st.Queued != 0 {
+		t.Fatalf("idle Conn: %+v", st)
+	}
+
+	w := c.Watch("/s", rev+1)
+	defer w.Cancel()
+	evc := make(chan *Event)
+	go func() {
+		ev, _ := w.Next()
+		evc <- ev
+	}()
+	if !settle(func() bool { return c.Stats().Watches == 1 }) {
+		t.Fatal("Watches never reached 1")
+	}
+	if n := c.Stats().InFlight; n != 1 {
+		t.Fatalf("InFlight during a watch: %d, want 1", n)
+	}
+
+	before := c.Stats().BytesRead
+	if _, err := c.Set("/s", clobber, []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	if ev := <-evc; ev == nil || string(ev.Body) != "new" {
+		t.Fatalf("watch event: %+v", ev)
+	}
+
+	st = c.Stats()
+	if st.Watches != 0 || st.InFlight != 0 {
+		t.Fatalf("after the event: %d watches, %d in flight", st.Watches, st.InFlight)
+	}
+	if st.Requests["WAIT"] != 1 || st.Requests["SET"] != 3 {
+		t.Fatalf("Requests: %v", st.Requests)
+	}
+	if st.BytesRead <= before {
+		t.Fatalf("BytesRead did not grow: %d", st.BytesRead)
+	}
+}
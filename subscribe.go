@@ -0,0 +1,79 @@
+package doozer
+
+import (
+	"io"
+	"sync"
+)
+
+// A Subscription calls a function for each change to files
+// matching a glob, in revision order, from its own goroutine.
+type Subscription struct {
+	w    *Watch
+	done chan bool
+
+	mu  sync.Mutex
+	err error
+}
+
+// Subscribe calls fn for each change to any file matching glob,
+// on or after rev, until the Subscription is cancelled or fails.
+func (c *Conn) Subscribe(glob string, rev int64, fn func(*Event)) *Subscription {
+	return NewSubscription(c, glob, rev, fn)
+}
+
+// NewSubscription acts like Conn.Subscribe, using d's Wait.
+func NewSubscription(d Doozer, glob string, rev int64, fn func(*Event)) *Subscription {
+	s := &Subscription{
+		w:    NewWatch(d, glob, rev),
+		done: make(chan bool),
+	}
+	go s.run(fn)
+	return s
+}
+
+func (s *Subscription) run(fn func(*Event)) {
+	defer close(s.done)
+	for {
+		ev, err := s.w.Next()
+		if err == io.EOF {
+			return
+		}
+		if err == nil {
+			err = s.call(fn, ev)
+		}
+		if err != nil {
+			s.mu.Lock()
+			s.err = err
+			s.mu.Unlock()
+			s.w.Cancel()
+			return
+		}
+	}
+}
+
+// call calls fn(ev), returning a panic in fn as an error.
+func (s *Subscription) call(fn func(*Event), ev *Event) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = recovered("Subscription callback", v)
+		}
+	}()
+	fn(ev)
+	return nil
+}
+
+// Err returns the error that stopped s: the stream's error if it
+// failed, or the panic if fn panicked. It returns nil while s is
+// running and after Cancel.
+func (s *Subscription) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Cancel stops s and waits for a call of fn in progress to return.
+// It must not be called from fn.
+func (s *Subscription) Cancel() {
+	s.w.Cancel()
+	<-s.done
+}
@@ -0,0 +1,142 @@
+package doozer
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSubscribeOrder(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+
+	from, err := c.Rev()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []int64
+	set := func(n int) {
+		for i := 0; i < n; i++ {
+			rev, err := c.Set("/s/"+string(rune('a'+i%3)), clobber, []byte("x"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want = append(want, rev)
+		}
+	}
+
+	// Some changes are made before Subscribe and some after.
+	set(10)
+	revs := make(chan int64, 100)
+	sub := c.Subscribe("/s/*", from+1, func(ev *Event) { revs <- ev.Rev })
+	defer sub.Cancel()
+	set(10)
+
+	for i, rev := range want {
+		select {
+		case got := <-revs:
+			if got != rev {
+				t.Fatalf("event %d: rev %d, want %d", i, got, rev)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("event %d never came", i)
+		}
+	}
+	if err := sub.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSubscribePanic(t *testing.T) {
+	logs := captureLog(t)
+	s := newServer(t)
+	c := dialServer(t, s)
+
+	from, err := c.Rev()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var calls int
+	sub := c.Subscribe("/p", from+1, func(ev *Event) {
+		if calls++; calls == 2 {
+			panic("boom")
+		}
+	})
+	defer sub.Cancel()
+	for i := 0; i < 3; i++ {
+		if _, err := c.Set("/p", clobber, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !settle(func() bool { return sub.Err() != nil }) {
+		t.Fatal("panic in fn not reported")
+	}
+	if err := sub.Err(); !strings.Contains(err.Error(), "panic in Subscription callback: boom") {
+		t.Fatalf("Err: %v", err)
+	}
+	if !strings.Contains(logs.String(), "boom") {
+		t.Fatalf("panic not logged: %q", logs)
+	}
+	sub.Cancel()
+	if calls != 2 {
+		t.Fatalf("fn called %d times, want 2", calls)
+	}
+
+	// The Conn carries on.
+	if _, err := c.Set("/p", clobber, []byte("after")); err != nil {
+		t.Fatal(err)
+	}
+	body, _, err := c.Get("/p", nil)
+	if err != nil || string(body) != "after" {
+		t.Fatalf("Get after the panic: %q %v", body, err)
+	}
+	if !settle(func() bool { return c.Stats().Watches == 0 }) {
+		t.Fatalf("Watches after the panic: %d", c.Stats().Watches)
+	}
+}
+
+func TestSubscribeCancelWaits(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+
+	from, err := c.Rev()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entered := make(chan bool)
+	release := make(chan bool)
+	var calls, finished int
+	sub := c.Subscribe("/c", from+1, func(ev *Event) {
+		calls++
+		entered <- true
+		<-release
+		finished++
+	})
+	for i := 0; i < 2; i++ {
+		if _, err := c.Set("/c", clobber, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-entered
+
+	cancelled := make(chan bool)
+	go func() {
+		sub.Cancel()
+		close(cancelled)
+	}()
+	select {
+	case <-cancelled:
+		t.Fatal("Cancel returned while fn was running")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+	<-cancelled
+	if calls != 1 || finished != 1 {
+		t.Fatalf("fn called %d times, finished %d, want 1 and 1", calls, finished)
+	}
+	if err := sub.Err(); err != nil {
+		t.Fatalf("Err after Cancel: %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package doozer
+
+import (
+	"fmt"
+	"log"
+	"runtime/debug"
+	"time"
+)
+
+// A Trace holds optional callbacks for observing the requests
+// a Conn makes. Any of them may be nil.
+//
+// All of them are called from the goroutine that made the request,
+// so a slow callback holds up only its own call, never the writer
+// or the reader. Still, they must be cheap, must not block, and
+// must not call back into the Conn.
+// A panic in a callback is logged, with its stack, and otherwise
+// ignored: the call goes on, and so does the Conn.
+type Trace struct {
+	// RequestSent is called as a request is handed over to be
+	// written, once it has its tag.
+	RequestSent func(verb, path string, tag int32, addr string)
+
+	// ResponseReceived is called when a request completes, with
+	// the error the call returns, and the time since it was sent.
+	ResponseReceived func(tag int32, err error, latency time.Duration)
+
+	// WatchEvent is called when a Wait returns an event.
+	WatchEvent func(tag int32)
+}
+
+// traceSent reports t to c.Trace, if any. It is called by the
+// caller, before t is handed to mux.
+func (c *Conn) traceSent(t *txn) {
+	tr := c.Trace
+	if tr == nil {
+		return
+	}
+	t.sent = time.Now()
+	if tr.RequestSent != nil {
+		defer recoverHook("RequestSent")
+		tr.RequestSent(t.req.GetVerb().String(), t.req.GetPath(), t.req.GetTag(), c.addr)
+	}
+}
+
+// recoverHook recovers from a panic in the callback what, and logs
+// it with the stack. A broken callback fails neither the call it
+// was told about nor the Conn.
+func recoverHook(what string) {
+	if v := recover(); v != nil {
+		recovered(what, v)
+	}
+}
+
+// recovered logs v, a value recovered from a panic in what,
+// with the stack, and returns an error describing it.
+func recovered(what string, v interface{}) error {
+	log.Printf("doozer: panic in %s: %v\n%s", what, v, debug.Stack())
+	return fmt.Errorf("doozer: panic in %s: %v", what, v)
+}
+
+// traceDone reports the outcome of t to c.Trace, if any.
+// It is called by the caller, after mux is done with t.
+func (c *Conn) traceDone(t *txn, err error) {
+	tr := c.Trace
+	if tr == nil || t.sent.IsZero() {
+		return
+	}
+	if tr.ResponseReceived != nil {
+		func() {
+			defer recoverHook("ResponseReceived")
+			tr.ResponseReceived(*t.req.Tag, err, time.Since(t.sent))
+		}()
+	}
+	if tr.WatchEvent != nil && err == nil && t.req.GetVerb() == request_WAIT {
+		defer recoverHook("WatchEvent")
+		tr.WatchEvent(*t.req.Tag)
+	}
+}
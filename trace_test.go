@@ -0,0 +1,175 @@
+package doozer
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestTracePanics checks that a panic in each Trace callback is
+// logged, and fails neither the call it was told about nor the Conn.
+func TestTracePanics(t *testing.T) {
+	boom := func() { panic("boom") }
+	for _, tt := range []struct {
+		name string
+		tr   *Trace
+	}{
+		{"RequestSent", &Trace{
+			RequestSent: func(string, string, int32, string) { boom() },
+		}},
+		{"ResponseReceived", &Trace{
+			ResponseReceived: func(int32, error, time.Duration) { boom() },
+		}},
+		{"WatchEvent", &Trace{
+			WatchEvent: func(int32) { boom() },
+		}},
+	} {
+		logs := captureLog(t)
+		s := newServer(t)
+		c := dialServer(t, s)
+		c.Trace = tt.tr
+
+		rev, err := c.Set("/a", clobber, []byte("1"))
+		if err != nil {
+			t.Fatalf("%s: Set: %v", tt.name, err)
+		}
+		ev, err := c.Wait("/a", rev)
+		if err != nil || string(ev.Body) != "1" {
+			t.Fatalf("%s: Wait: %+v %v", tt.name, ev, err)
+		}
+		body, _, err := c.Get("/a", nil)
+		if err != nil || string(body) != "1" {
+			t.Fatalf("%s: Get after the panics: %q %v", tt.name, body, err)
+		}
+		if !strings.Contains(logs.String(), "panic in "+tt.name+": boom") {
+			t.Fatalf("%s: panic not logged: %q", tt.name, logs)
+		}
+	}
+}
+
+// TestTraceSentBlocksOnlyItsCall checks that RequestSent runs in the
+// calling goroutine: while it blocks for one call, others go through.
+func TestTraceSentBlocksOnlyItsCall(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+
+	block := make(chan bool)
+	entered := make(chan bool)
+	c.Trace = &Trace{
+		RequestSent: func(verb, path string, tag int32, addr string) {
+			if verb == "SET" && path == "/slow" {
+				entered <- true
+				<-block
+			}
+		},
+	}
+
+	done := make(chan error)
+	go func() {
+		_, err := c.Set("/slow", clobber, []byte("x"))
+		done <- err
+	}()
+	<-entered
+
+	fast := make(chan error, 1)
+	go func() {
+		for i := 0; i < 10; i++ {
+			if _, err := c.Set("/fast", clobber, []byte("y")); err != nil {
+				fast <- err
+				return
+			}
+		}
+		_, _, err := c.Get("/fast", nil)
+		fast <- err
+	}()
+	select {
+	case err := <-fast:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		close(block)
+		t.Fatal("calls held up behind a blocked RequestSent")
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("Set returned while RequestSent blocked: %v", err)
+	default:
+	}
+
+	close(block)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	body, _, err := c.Get("/slow", nil)
+	if err != nil || string(body) != "x" {
+		t.Fatalf("Get of the slow file: %q %v", body, err)
+	}
+}
+
+// TestTraceTags checks that each call is reported once to
+// RequestSent and once to ResponseReceived, under the same tag,
+// and that calls in flight together have different tags.
+func TestTraceTags(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+
+	var mu sync.Mutex
+	sent := map[int32]string{}
+	received := map[int32]int{}
+	var live, reused int
+	c.Trace = &Trace{
+		RequestSent: func(verb, path string, tag int32, addr string) {
+			mu.Lock()
+			defer mu.Unlock()
+			if _, ok := sent[tag]; ok && received[tag] == 0 {
+				reused++
+			}
+			sent[tag] = verb + " " + path
+			received[tag] = 0
+			live++
+			if addr != s.Addr {
+				t.Errorf("RequestSent addr %q, want %q", addr, s.Addr)
+			}
+		},
+		ResponseReceived: func(tag int32, err error, latency time.Duration) {
+			mu.Lock()
+			defer mu.Unlock()
+			if _, ok := sent[tag]; !ok {
+				t.Errorf("ResponseReceived for unsent tag %d", tag)
+			}
+			received[tag]++
+			live--
+			if err != nil || latency < 0 {
+				t.Errorf("ResponseReceived(%d, %v, %v)", tag, err, latency)
+			}
+		},
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.Set("/t", clobber, nil); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if reused != 0 {
+		t.Errorf("%d tags handed out while still in use", reused)
+	}
+	if live != 0 {
+		t.Errorf("%d calls reported sent but never received", live)
+	}
+	for tag, n := range received {
+		if n != 1 {
+			t.Errorf("tag %d (%s): %d responses, want 1", tag, sent[tag], n)
+		}
+	}
+}
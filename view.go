@@ -0,0 +1,68 @@
+package doozer
+
+// A View is a read-only view of the store pinned at one revision.
+// Every read made through a View uses that revision.
+type View struct {
+	c   *Conn
+	rev int64
+}
+
+// At returns a View of the store as of revision rev.
+func (c *Conn) At(rev int64) View {
+	return View{c, rev}
+}
+
+// Now returns a View of the store as of its current revision.
+func (c *Conn) Now() (View, error) {
+	rev, err := c.Rev()
+	if err != nil {
+		return View{}, err
+	}
+	return c.At(rev), nil
+}
+
+// Rev returns the revision v is pinned to.
+func (v View) Rev() int64 {
+	return v.rev
+}
+
+// Get returns the body and revision of the file at path.
+func (v View) Get(file string) ([]byte, int64, error) {
+	return v.c.Get(file, &v.rev)
+}
+
+// Stat returns metadata about the file or directory at path.
+func (v View) Stat(path string) (int, int64, error) {
+	return v.c.Stat(path, &v.rev)
+}
+
+// Statinfo returns metadata about the file or directory at path.
+func (v View) Statinfo(path string) (*FileInfo, error) {
+	return v.c.Statinfo(v.rev, path)
+}
+
+// Exists reports whether a file or directory exists at path.
+func (v View) Exists(path string) (bool, int64, error) {
+	return v.c.Exists(path, &v.rev)
+}
+
+// Getdir reads up to lim names from dir, as in Conn.Getdir.
+func (v View) Getdir(dir string, off, lim int) ([]string, error) {
+	return v.c.Getdir(dir, v.rev, off, lim)
+}
+
+// Getdirinfo reads metadata for up to lim files from dir,
+// as in Conn.Getdirinfo.
+func (v View) Getdirinfo(dir string, off, lim int) ([]FileInfo, error) {
+	return v.c.Getdirinfo(dir, v.rev, off, lim)
+}
+
+// Walk reads up to lim entries matching glob, as in Conn.Walk.
+func (v View) Walk(glob string, off, lim int) ([]Event, error) {
+	return v.c.Walk(glob, v.rev, off, lim)
+}
+
+// GetMulti reads each file in paths, as in Conn.GetMulti.
+func (v View) GetMulti(paths []string) ([]Result, error) {
+	return v.c.GetMulti(paths, &v.rev)
+}
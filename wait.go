@@ -0,0 +1,56 @@
+package doozer
+
+import (
+	"time"
+)
+
+// WaitFile waits until file exists, then returns its body and
+// revision. If file already exists, WaitFile returns at once.
+// A timeout of zero or less means to wait forever; otherwise,
+// once the timeout expires, WaitFile returns ErrWaitTimeout.
+func (c *Conn) WaitFile(file string, timeout time.Duration) ([]byte, int64, error) {
+	return c.WaitFileFunc(file, timeout, func([]byte) bool { return true })
+}
+
+// WaitFileFunc acts like WaitFile, but keeps waiting until file
+// exists and ok reports true for its body.
+func (c *Conn) WaitFileFunc(file string, timeout time.Duration, ok func(body []byte) bool) ([]byte, int64, error) {
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+
+	rev, err := c.Rev()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Reading at rev and then waiting from rev+1 sees every
+	// change, with no gap between the read and the wait.
+	body, frev, err := c.Get(file, &rev)
+	if err != nil {
+		return nil, 0, err
+	}
+	if frev > 0 && ok(body) {
+		return body, frev, nil
+	}
+
+	for {
+		var d time.Duration
+		if !deadline.IsZero() {
+			d = deadline.Sub(time.Now())
+			if d <= 0 {
+				return nil, 0, ErrWaitTimeout
+			}
+		}
+
+		ev, err := c.WaitTimeout(file, rev+1, d)
+		if err != nil {
+			return nil, 0, err
+		}
+		if ev.IsSet() && ok(ev.Body) {
+			return ev.Body, ev.Rev, nil
+		}
+		rev = ev.Rev
+	}
+}
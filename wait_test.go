@@ -0,0 +1,127 @@
+package doozer
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWaitFileExists(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+
+	rev, err := c.Set("/w", clobber, []byte("here"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, frev, err := c.WaitFile("/w", time.Second)
+	if err != nil || string(body) != "here" || frev != rev {
+		t.Fatalf("WaitFile: %q %d %v", body, frev, err)
+	}
+	if n := c.Stats().Requests["WAIT"]; n != 0 {
+		t.Fatalf("WAIT requests for a file that exists: %d", n)
+	}
+}
+
+func TestWaitFileLater(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+	other := dialServer(t, s)
+
+	revc := make(chan int64, 1)
+	time.AfterFunc(20*time.Millisecond, func() {
+		rev, err := other.Set("/w", clobber, []byte("late"))
+		if err != nil {
+			t.Error(err)
+		}
+		revc <- rev
+	})
+	body, frev, err := c.WaitFile("/w", 0)
+	if err != nil || string(body) != "late" {
+		t.Fatalf("WaitFile: %q %v", body, err)
+	}
+	if rev := <-revc; frev != rev {
+		t.Fatalf("WaitFile rev: %d, want %d", frev, rev)
+	}
+}
+
+// TestWaitFileFunc changes a file several times, deleting it once,
+// before its body satisfies the predicate.
+func TestWaitFileFunc(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+	other := dialServer(t, s)
+
+	if _, err := c.Set("/w", clobber, []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+
+	// The changes start once the predicate has seen the first body.
+	var mu sync.Mutex
+	var seen []string
+	start := make(chan bool)
+	ready := func(body []byte) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		if seen = append(seen, string(body)); len(seen) == 1 {
+			close(start)
+		}
+		return string(body) == "ready"
+	}
+
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		<-start
+		for _, body := range []string{"b", "", "c", "ready", "after"} {
+			var err error
+			if body == "" {
+				err = other.Del("/w", clobber)
+			} else {
+				_, err = other.Set("/w", clobber, []byte(body))
+			}
+			if err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+
+	body, frev, err := c.WaitFileFunc("/w", 5*time.Second, ready)
+	<-done
+	if err != nil || string(body) != "ready" {
+		t.Fatalf("WaitFileFunc: %q %v", body, err)
+	}
+	_, srev, err := c.Stat("/w", &frev)
+	if err != nil || srev != frev {
+		t.Fatalf("rev %d isn't the ready body's: %d %v", frev, srev, err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"a", "b", "c", "ready"}
+	if len(seen) != len(want) {
+		t.Fatalf("predicate saw %q, want %q", seen, want)
+	}
+	for i := range want {
+		if seen[i] != want[i] {
+			t.Fatalf("predicate saw %q, want %q", seen, want)
+		}
+	}
+}
+
+func TestWaitFileTimeout(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+
+	if _, err := c.Set("/w", clobber, []byte("no")); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	_, _, err := c.WaitFileFunc("/w", 30*time.Millisecond, func([]byte) bool { return false })
+	if err != ErrWaitTimeout {
+		t.Fatalf("WaitFileFunc: %v, want ErrWaitTimeout", err)
+	}
+	if d := time.Since(start); d < 30*time.Millisecond || d > time.Second {
+		t.Fatalf("timed out after %v", d)
+	}
+}
@@ -1,5 +1,12 @@
 package doozer
 
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+)
+
 type Visitor interface {
 	VisitDir(path string, f *FileInfo) bool
 	VisitFile(path string, f *FileInfo)
@@ -7,7 +14,7 @@ type Visitor interface {
 
 // Walk walks the file tree in revision rev, rooted at root,
 // analogously to Walk in package path/filepath.
-func Walk(c *Conn, rev int64, root string, v Visitor, errors chan<- error) {
+func Walk(c Doozer, rev int64, root string, v Visitor, errors chan<- error) {
 	f, err := c.Statinfo(rev, root)
 	if err != nil {
 		if errors != nil {
@@ -18,7 +25,7 @@ func Walk(c *Conn, rev int64, root string, v Visitor, errors chan<- error) {
 	walk(c, rev, root, f, v, errors)
 }
 
-func walk(c *Conn, r int64, path string, f *FileInfo, v Visitor, errors chan<- error) {
+func walk(c Doozer, r int64, path string, f *FileInfo, v Visitor, errors chan<- error) {
 	if !f.IsDir {
 		v.VisitFile(path, f)
 		return
@@ -40,3 +47,123 @@ func walk(c *Conn, r int64, path string, f *FileInfo, v Visitor, errors chan<- e
 		walk(c, r, path+list[i].Name, &list[i], v, errors)
 	}
 }
+
+// WalkOptions limit what WalkWith reads. A zero field means no limit.
+type WalkOptions struct {
+	// MaxDepth is how many levels below the glob's fixed prefix,
+	// the part before its first wildcard, to descend.
+	// Files directly in that directory are at depth 1.
+	MaxDepth int
+
+	// MaxResults is how many files to return.
+	MaxResults int
+
+	// BodyLimit is the longest body to read. A longer file is
+	// returned with Truncated set and a nil Body.
+	BodyLimit int
+}
+
+// errEnough stops a walk once it has all the results it needs.
+var errEnough = errors.New("enough")
+
+// WalkWith acts like Conn.Walk reading every entry from the start,
+// within the limits of opt. The server knows nothing of depth or
+// body limits, so with those set, WalkWith lists directories and
+// stats files itself, fetching only the bodies it returns. Either
+// way, files come in order of their paths, as from Walk: /a-c comes
+// before /a/b, since '-' sorts before '/'.
+func (c *Conn) WalkWith(glob string, rev int64, opt WalkOptions) ([]Event, error) {
+	if opt.MaxDepth <= 0 && opt.BodyLimit <= 0 {
+		lim := opt.MaxResults
+		if lim <= 0 {
+			lim = -1
+		}
+		return c.Walk(glob, rev, 0, lim)
+	}
+
+	re, err := compileGlob(glob)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &limitWalker{c: c, rev: rev, re: re, opt: opt}
+	root := glob[:strings.LastIndex(glob[:literalLen(glob)], "/")+1]
+	err = w.walk(root, 1)
+	if err != nil && err != errEnough {
+		return nil, err
+	}
+	return w.evs, nil
+}
+
+type limitWalker struct {
+	c   *Conn
+	rev int64
+	re  *regexp.Regexp
+	opt WalkOptions
+	evs []Event
+}
+
+// walk visits the entries of dir, a path ending in a slash,
+// which are at the given depth.
+func (w *limitWalker) walk(dir string, depth int) error {
+	list, err := w.c.getdirinfoOpt(strings.TrimSuffix(dir, "/"), w.rev)
+	if err != nil {
+		return err
+	}
+
+	// Every path under a directory starts with its name and a
+	// slash, so sorting on that visits files in path order.
+	sort.Sort(byWalkOrder(list))
+
+	for _, f := range list {
+		path := dir + f.Name
+		if f.IsDir {
+			if w.opt.MaxDepth <= 0 || depth < w.opt.MaxDepth {
+				err = w.walk(path+"/", depth+1)
+				if err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if !w.re.MatchString(path) {
+			continue
+		}
+
+		ev := Event{
+			Rev:       f.Rev,
+			Path:      path,
+			Name:      f.Name,
+			Flag:      set,
+			Synthetic: true,
+		}
+		if w.opt.BodyLimit > 0 && f.Len > w.opt.BodyLimit {
+			ev.Truncated = true
+		} else {
+			ev.Body, _, err = w.c.Get(path, &w.rev)
+			if err != nil {
+				return err
+			}
+		}
+		w.evs = append(w.evs, ev)
+		if len(w.evs) == w.opt.MaxResults {
+			return errEnough
+		}
+	}
+	return nil
+}
+
+// byWalkOrder sorts the entries of one directory so that walking
+// them depth-first yields paths in sorted order.
+type byWalkOrder []FileInfo
+
+func (l byWalkOrder) Len() int           { return len(l) }
+func (l byWalkOrder) Less(i, j int) bool { return l[i].walkKey() < l[j].walkKey() }
+func (l byWalkOrder) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+
+func (f *FileInfo) walkKey() string {
+	if f.IsDir {
+		return f.Name + "/"
+	}
+	return f.Name
+}
@@ -0,0 +1,83 @@
+package doozer
+
+import (
+	"strings"
+	"testing"
+)
+
+func paths(evs []Event) string {
+	var ps []string
+	for _, ev := range evs {
+		ps = append(ps, ev.Path)
+	}
+	return strings.Join(ps, " ")
+}
+
+func TestWalkWith(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+
+	files := map[string]string{
+		"/t/a/b":     "1",
+		"/t/a-c":     "2",
+		"/t/a/x/y":   "3",
+		"/t/ab":      "4",
+		"/t/big":     strings.Repeat("x", 100),
+		"/t/a.d/e/f": "5",
+	}
+	for p, b := range files {
+		if _, err := c.Set(p, clobber, []byte(b)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rev, _ := c.Rev()
+
+	all, err := c.Walk("/t/**", rev, 0, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Depth and body limits that cut nothing must not change
+	// the order either.
+	evs, err := c.WalkWith("/t/**", rev, WalkOptions{MaxDepth: 10, BodyLimit: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if paths(evs) != paths(all) {
+		t.Fatalf("WalkWith order:\n%s\nWalk order:\n%s", paths(evs), paths(all))
+	}
+	for _, ev := range evs {
+		if string(ev.Body) != files[ev.Path] || ev.Truncated {
+			t.Fatalf("%s: %q truncated=%v", ev.Path, ev.Body, ev.Truncated)
+		}
+	}
+
+	tests := []struct {
+		glob string
+		opt  WalkOptions
+		want string
+	}{
+		{"/t/**", WalkOptions{MaxDepth: 1}, "/t/a-c /t/ab /t/big"},
+		{"/t/**", WalkOptions{MaxDepth: 2}, "/t/a-c /t/a/b /t/ab /t/big"},
+		{"/t/**", WalkOptions{MaxDepth: 3, MaxResults: 3}, "/t/a-c /t/a.d/e/f /t/a/b"},
+		{"/t/a/**", WalkOptions{MaxDepth: 1}, "/t/a/b"},
+		{"/t/*", WalkOptions{MaxResults: 2}, "/t/a-c /t/ab"},
+		{"/t/a*", WalkOptions{BodyLimit: 1}, "/t/a-c /t/ab"},
+	}
+	for _, tt := range tests {
+		evs, err := c.WalkWith(tt.glob, rev, tt.opt)
+		if err != nil || paths(evs) != tt.want {
+			t.Errorf("WalkWith(%s, %+v): %s %v, want %s", tt.glob, tt.opt, paths(evs), err, tt.want)
+		}
+	}
+
+	evs, err = c.WalkWith("/t/*", rev, WalkOptions{BodyLimit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ev := range evs {
+		long := len(files[ev.Path]) > 10
+		if ev.Truncated != long || (long && ev.Body != nil) || (!long && string(ev.Body) != files[ev.Path]) {
+			t.Errorf("BodyLimit 10: %s: %q truncated=%v", ev.Path, ev.Body, ev.Truncated)
+		}
+	}
+}
@@ -0,0 +1,352 @@
+package doozer
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoGlobs is returned by WatchAll when given no globs.
+var ErrNoGlobs = errors.New("no globs")
+
+// A Watch is a stream of changes to files matching a glob,
+// read one at a time with Next.
+type Watch struct {
+	c      Doozer
+	glob   string
+	rev    int64
+	cancel chan bool
+	once   sync.Once
+
+	pending []*Event // returned by Next before any wait
+
+	// For a Watch made by WatchAll, the watches it merges.
+	// Next owns queues, last and seen.
+	subs    []*Watch
+	start   sync.Once
+	results chan mergeResult
+	queues  [][]*Event        // events received from each sub, not yet returned
+	last    []int64           // rev of the last event received from each sub
+	seen    map[mergeKey]bool // events returned that a sub may yet repeat
+
+	mu  sync.Mutex
+	err error
+}
+
+// Watch returns a Watch for changes to any file matching glob,
+// on or after rev.
+func (c *Conn) Watch(glob string, rev int64) *Watch {
+	return NewWatch(c, glob, rev)
+}
+
+// NewWatch returns a Watch for changes to any file matching glob,
+// on or after rev, using d's Wait.
+func NewWatch(d Doozer, glob string, rev int64) *Watch {
+	return &Watch{
+		c:      d,
+		glob:   glob,
+		rev:    rev,
+		cancel: make(chan bool),
+	}
+}
+
+// WatchWithCurrent returns a Watch whose first events describe
+// the files matching glob as they are now, with Initial set, and
+// whose later events follow each change from there, so no change
+// is missed or reported twice. If glob names a single file and
+// there is no such file, the one initial event has IsDel true.
+func (c *Conn) WatchWithCurrent(glob string) (*Watch, error) {
+	rev, err := c.Rev()
+	if err != nil {
+		return nil, err
+	}
+
+	evs, err := c.Walk(glob, rev, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	w := c.Watch(glob, rev+1)
+	for i := range evs {
+		evs[i].Flag = set
+		evs[i].Initial = true
+		w.pending = append(w.pending, &evs[i])
+	}
+	if len(evs) == 0 && literalLen(glob) == len(glob) {
+		w.pending = append(w.pending, &Event{
+			Rev:       rev,
+			Path:      glob,
+			Name:      basename(glob),
+			Flag:      del,
+			Initial:   true,
+			Synthetic: true,
+		})
+	}
+	return w, nil
+}
+
+// mergeWindow is how long a Watch made by WatchAll holds back an
+// event while waiting to hear from a quiet stream.
+const mergeWindow = 10 * time.Millisecond
+
+// WatchAll returns a single Watch for changes to files matching
+// any of globs, on or after rev. It waits on each glob separately,
+// on c, and merges the streams into revision order, reporting a
+// change that matches several globs once.
+//
+// Each stream is in order by itself. To put them in order with one
+// another, Next holds back an event until every stream has sent one,
+// or for mergeWindow if some stream is quiet; a change that reaches
+// c later than that may come out of order.
+func (c *Conn) WatchAll(globs []string, rev int64) (*Watch, error) {
+	if len(globs) == 0 {
+		return nil, ErrNoGlobs
+	}
+	if len(globs) == 1 {
+		return c.Watch(globs[0], rev), nil
+	}
+
+	w := NewWatch(c, strings.Join(globs, " "), rev)
+	w.results = make(chan mergeResult)
+	w.queues = make([][]*Event, len(globs))
+	w.last = make([]int64, len(globs))
+	w.seen = make(map[mergeKey]bool)
+	for i, glob := range globs {
+		w.subs = append(w.subs, c.Watch(glob, rev))
+		w.last[i] = rev - 1
+	}
+	return w, nil
+}
+
+type mergeResult struct {
+	i   int
+	ev  *Event
+	err error
+}
+
+type mergeKey struct {
+	rev  int64
+	path string
+}
+
+// feed sends the events of w.subs[i] to w.results until it stops.
+func (w *Watch) feed(i int) {
+	for {
+		ev, err := w.subs[i].Next()
+		select {
+		case w.results <- mergeResult{i, ev, err}:
+		case <-w.cancel:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// nextMerged returns the next event of a Watch made by WatchAll.
+func (w *Watch) nextMerged() (*Event, error) {
+	w.start.Do(func() {
+		for i := range w.subs {
+			go w.feed(i)
+		}
+	})
+
+	var timeout <-chan time.Time
+	expired := false
+	for {
+		if i := w.earliest(); i >= 0 {
+			if expired || w.allQueued() {
+				ev := w.queues[i][0]
+				w.queues[i] = w.queues[i][1:]
+				if w.dup(ev) {
+					continue
+				}
+				return ev, nil
+			}
+			if timeout == nil {
+				t := time.NewTimer(mergeWindow)
+				defer t.Stop()
+				timeout = t.C
+			}
+		}
+
+		select {
+		case r := <-w.results:
+			if r.err == io.EOF {
+				return nil, io.EOF
+			}
+			if r.err != nil {
+				w.stop(r.err)
+				w.Cancel()
+				return nil, r.err
+			}
+			w.queues[r.i] = append(w.queues[r.i], r.ev)
+			w.last[r.i] = r.ev.Rev
+		case <-timeout:
+			expired = true
+		case <-w.cancel:
+			return nil, io.EOF
+		}
+	}
+}
+
+// earliest returns the index of the queue whose first event has
+// the lowest rev, or -1 if every queue is empty.
+func (w *Watch) earliest() int {
+	min := -1
+	for i, q := range w.queues {
+		if len(q) > 0 && (min < 0 || q[0].Rev < w.queues[min][0].Rev) {
+			min = i
+		}
+	}
+	return min
+}
+
+func (w *Watch) allQueued() bool {
+	for _, q := range w.queues {
+		if len(q) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// dup reports whether ev has been returned already, from another
+// sub, and records it if not. It forgets events that no sub can
+// repeat: those before every sub's queue and later events.
+func (w *Watch) dup(ev *Event) bool {
+	k := mergeKey{ev.Rev, ev.Path}
+	if w.seen[k] {
+		return true
+	}
+	w.seen[k] = true
+
+	low := ev.Rev
+	for i, r := range w.last {
+		if q := w.queues[i]; len(q) > 0 {
+			r = q[0].Rev - 1
+		}
+		if r < low {
+			low = r
+		}
+	}
+	for k := range w.seen {
+		if k.rev <= low {
+			delete(w.seen, k)
+		}
+	}
+	return false
+}
+
+// literalLen returns the length of the part of glob
+// before its first wildcard.
+func literalLen(glob string) int {
+	if i := strings.IndexAny(glob, "*?"); i >= 0 {
+		return i
+	}
+	return len(glob)
+}
+
+// Next waits for the next change and returns it.
+// After Cancel, Next returns io.EOF. If the stream fails,
+// Next returns the error, and keeps returning it thereafter.
+// Next must not be called concurrently with itself.
+func (w *Watch) Next() (*Event, error) {
+	if err := w.Err(); err == ErrCancelled {
+		return nil, io.EOF
+	} else if err != nil {
+		return nil, err
+	}
+
+	if len(w.pending) > 0 {
+		ev := w.pending[0]
+		w.pending = w.pending[1:]
+		return ev, nil
+	}
+	if w.subs != nil {
+		return w.nextMerged()
+	}
+
+	ev, err := w.wait()
+	if err == io.EOF {
+		return nil, err
+	}
+	if err != nil {
+		w.stop(err)
+		return nil, err
+	}
+	w.rev = ev.Rev + 1
+	return &ev, nil
+}
+
+// A waitCanceler can abandon a Wait when cancel is closed,
+// so that nothing is left waiting on its behalf.
+type waitCanceler interface {
+	waitCancel(glob string, rev int64, cancel <-chan bool) (Event, error)
+}
+
+// wait waits for the next change after w.rev, returning io.EOF
+// if w is cancelled first. If w's Doozer can't abandon a Wait,
+// the Wait is left to finish in a goroutine of its own.
+func (w *Watch) wait() (Event, error) {
+	if wc, ok := w.c.(waitCanceler); ok {
+		ev, err := wc.waitCancel(w.glob, w.rev, w.cancel)
+		if err == ErrCancelled {
+			return Event{}, io.EOF
+		}
+		return ev, err
+	}
+
+	type result struct {
+		ev  Event
+		err error
+	}
+	ch := make(chan result, 1)
+	go func(rev int64) {
+		ev, err := w.c.Wait(w.glob, rev)
+		ch <- result{ev, err}
+	}(w.rev)
+
+	select {
+	case r := <-ch:
+		return r.ev, r.err
+	case <-w.cancel:
+		return Event{}, io.EOF
+	}
+}
+
+// Err returns the reason w stopped: ErrCancelled after Cancel,
+// the error that ended the stream if it failed, or nil if w
+// is still running.
+func (w *Watch) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+// stop records err as the reason w stopped, unless one is
+// recorded already.
+func (w *Watch) stop(err error) {
+	w.mu.Lock()
+	if w.err == nil {
+		w.err = err
+	}
+	w.mu.Unlock()
+}
+
+// Cancel stops w. A call to Next blocked in w returns promptly.
+// If w reads from a Conn, its pending wait is abandoned at once,
+// though the server keeps it open until the next matching change;
+// see WaitTimeout.
+func (w *Watch) Cancel() {
+	w.once.Do(func() {
+		w.stop(ErrCancelled)
+		close(w.cancel)
+		for _, sub := range w.subs {
+			sub.Cancel()
+		}
+	})
+}
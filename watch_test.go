@@ -0,0 +1,355 @@
+package doozer
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ha/doozer/doozertest"
+)
+
+func TestCancelledWatchesDontLeak(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+
+	rev, err := c.Rev()
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := clientGoroutines()
+
+	for i := 0; i < 100; i++ {
+		w := c.Watch("/leak/**", rev+1)
+		done := make(chan error)
+		go func() {
+			_, err := w.Next()
+			done <- err
+		}()
+		if !settle(func() bool { return c.Stats().Watches == 1 }) {
+			t.Fatal("watch never started")
+		}
+		w.Cancel()
+		if err := <-done; err == nil {
+			t.Fatal("Next after Cancel returned an event")
+		}
+	}
+
+	sub := c.Subscribe("/leak/**", rev+1, func(*Event) {})
+	settle(func() bool { return c.Stats().Watches == 1 })
+	sub.Cancel()
+
+	b := NewBarrier(c, "/leak/barrier", 2)
+	time.AfterFunc(20*time.Millisecond, b.Cancel)
+	if err := b.Enter("a"); err == nil {
+		t.Fatal("Enter after Cancel succeeded")
+	}
+
+	_, _, err = c.WaitFile("/leak/never", 10*time.Millisecond)
+	if err != ErrWaitTimeout {
+		t.Fatalf("WaitFile: got %v, want ErrWaitTimeout", err)
+	}
+
+	opt := PublishOptions{Timeout: 10 * time.Millisecond}
+	_, _, err = c.PublishAndWait("/leak/cfg", nil, "/leak/barrier/*", "/leak/ack/*", opt)
+	if err != ErrWaitTimeout {
+		t.Fatalf("PublishAndWait: got %v, want ErrWaitTimeout", err)
+	}
+
+	ca, err := NewCache(c, "/leak/**", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	settle(func() bool { return c.Stats().Watches == 1 })
+	ca.Close()
+
+	if !settle(func() bool { return clientGoroutines() <= base }) {
+		t.Fatalf("client goroutines: %d, want at most %d", clientGoroutines(), base)
+	}
+	if n := c.Stats().Watches; n != 0 {
+		t.Fatalf("Watches: %d, want 0", n)
+	}
+}
+
+// TestCancelDuringClose cancels watches waiting on a Conn while the
+// Conn is being closed. Every Next must return, and nothing may be
+// left running.
+func TestCancelDuringClose(t *testing.T) {
+	s := newServer(t)
+	for round := 0; round < 20; round++ {
+		base := clientGoroutines()
+		c := dialServer(t, s)
+		rev, err := c.Rev()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		const n = 50
+		ws := make([]*Watch, n)
+		errc := make(chan error, n)
+		for i := range ws {
+			ws[i] = c.Watch("/never", rev+1)
+			go func(w *Watch) {
+				_, err := w.Next()
+				errc <- err
+			}(ws[i])
+		}
+		if !settle(func() bool { return c.Stats().Watches == n }) {
+			t.Fatalf("watches: %d, want %d", c.Stats().Watches, n)
+		}
+
+		start := make(chan bool)
+		for _, w := range ws {
+			go func(w *Watch) {
+				<-start
+				w.Cancel()
+			}(w)
+		}
+		go func() {
+			<-start
+			c.Close()
+		}()
+		close(start)
+
+		for range ws {
+			select {
+			case err := <-errc:
+				if err == nil {
+					t.Fatal("Next returned an event")
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("Next still blocked after Cancel and Close")
+			}
+		}
+
+		// Cancel on a closed Conn returns at once.
+		w := c.Watch("/never", rev+1)
+		w.Cancel()
+		if _, err := w.Next(); err == nil {
+			t.Fatal("Next after Close and Cancel returned an event")
+		}
+
+		if !settle(func() bool { return clientGoroutines() <= base }) {
+			t.Fatalf("client goroutines: %d, want at most %d", clientGoroutines(), base)
+		}
+	}
+}
+
+// TestWatchWithCurrentRace sets the file while WatchWithCurrent
+// is reading its current body, and checks that the change is seen
+// exactly once.
+func TestWatchWithCurrentRace(t *testing.T) {
+	s, err := doozertest.NewUnstartedServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	other := make(chan *Conn, 1)
+	var once sync.Once
+	s.Fail = func(verb, path string) error {
+		if verb == "WALK" && path == "/cur" {
+			once.Do(func() {
+				if _, err := (<-other).Set("/cur", clobber, []byte("raced")); err != nil {
+					t.Error(err)
+				}
+			})
+		}
+		return nil
+	}
+	s.Start()
+	c := dialServer(t, s)
+	other <- dialServer(t, s)
+
+	if _, err := c.Set("/cur", clobber, []byte("old")); err != nil {
+		t.Fatal(err)
+	}
+	w, err := c.WatchWithCurrent("/cur")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Cancel()
+
+	ev, err := w.Next()
+	if err != nil || !ev.Initial || string(ev.Body) != "old" {
+		t.Fatalf("first event: %+v %v, want the initial body", ev, err)
+	}
+	ev, err = w.Next()
+	if err != nil || ev.Initial || string(ev.Body) != "raced" {
+		t.Fatalf("second event: %+v %v, want the raced set", ev, err)
+	}
+	if _, err := c.Set("/cur", clobber, []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	ev, err = w.Next()
+	if err != nil || string(ev.Body) != "new" {
+		t.Fatalf("third event: %+v %v, want the later set", ev, err)
+	}
+}
+
+func TestWatchWithCurrentGlob(t *testing.T) {
+	s := newServer(t)
+	c := dialServer(t, s)
+
+	for _, p := range []string{"/g/a", "/g/b"} {
+		if _, err := c.Set(p, clobber, []byte(p)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w, err := c.WatchWithCurrent("/g/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Cancel()
+	for _, p := range []string{"/g/a", "/g/b"} {
+		ev, err := w.Next()
+		if err != nil || !ev.Initial || !ev.IsSet() || ev.Path != p {
+			t.Fatalf("initial event: %+v %v, want %s", ev, err, p)
+		}
+	}
+	if err := c.Del("/g/a", clobber); err != nil {
+		t.Fatal(err)
+	}
+	ev, err := w.Next()
+	if err != nil || ev.Initial || !ev.IsDel() || ev.Path != "/g/a" {
+		t.Fatalf("live event: %+v %v", ev, err)
+	}
+
+	w, err = c.WatchWithCurrent("/g/none")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Cancel()
+	ev, err = w.Next()
+	if err != nil || !ev.Initial || !ev.IsDel() || ev.Path != "/g/none" {
+		t.Fatalf("initial event of a missing file: %+v %v", ev, err)
+	}
+}
+
+// BenchmarkWatchDrain reads 10k events from a Watch.
+func BenchmarkWatchDrain(b *testing.B) {
+	s := newServer(b)
+	c := dialServer(b, s)
+
+	const n = 10000
+	ops := make([]SetOp, n)
+	for i := range ops {
+		ops[i] = SetOp{Path: "/drain", OldRev: clobber, Body: []byte("body")}
+	}
+	from, err := c.Rev()
+	if err != nil {
+		b.Fatal(err)
+	}
+	if _, err := c.SetMulti(ops); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w := c.Watch("/drain", from+1)
+		for j := 0; j < n; j++ {
+			if _, err := w.Next(); err != nil {
+				b.Fatal(err)
+			}
+		}
+		w.Cancel()
+	}
+}
+
+// TestWatchAll checks that WatchAll waits on each glob, not on a
+// prefix of them all, and returns the changes in revision order,
+// once each.
+func TestWatchAll(t *testing.T) {
+	s := newServer(t)
+	var mu sync.Mutex
+	waits := map[string]bool{}
+	s.Fail = func(verb, path string) error {
+		if verb == "WAIT" {
+			mu.Lock()
+			waits[path] = true
+			mu.Unlock()
+		}
+		return nil
+	}
+	c := dialServer(t, s)
+
+	from, err := c.Rev()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// /x/a matches two globs; /z/c matches none.
+	paths := []string{"/x/a", "/y/b", "/z/c", "/y/b", "/x/a", "/x/b", "/z/c", "/y/c"}
+	var want []int64
+	for _, p := range paths {
+		rev, err := c.Set(p, clobber, []byte(p))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p[1] != 'z' {
+			want = append(want, rev)
+		}
+	}
+
+	w, err := c.WatchAll([]string{"/x/*", "/y/*", "/x/a"}, from+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Cancel()
+	for i, rev := range want {
+		ev, err := w.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ev.Rev != rev {
+			t.Fatalf("event %d: %s, want rev %d", i, ev, rev)
+		}
+	}
+
+	// Live changes, written while Next waits, come in order too.
+	done := make(chan []int64)
+	go func() {
+		var revs []int64
+		for _, p := range []string{"/y/b", "/z/c", "/x/a", "/y/c", "/x/b"} {
+			rev, err := c.Set(p, clobber, nil)
+			if err != nil {
+				t.Error(err)
+			}
+			if p[1] != 'z' {
+				revs = append(revs, rev)
+			}
+		}
+		done <- revs
+	}()
+	var got []int64
+	for len(got) < 4 {
+		ev, err := w.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, ev.Rev)
+	}
+	live := <-done
+	for i := range live {
+		if got[i] != live[i] {
+			t.Fatalf("live revs: %v, want %v", got, live)
+		}
+	}
+
+	if n := c.Stats().Watches; n != 3 {
+		t.Errorf("Watches: %d, want one per glob", n)
+	}
+	mu.Lock()
+	for p := range waits {
+		if p != "/x/*" && p != "/y/*" && p != "/x/a" {
+			t.Errorf("waited on %q", p)
+		}
+	}
+	mu.Unlock()
+
+	w.Cancel()
+	if _, err := w.Next(); err == nil {
+		t.Fatal("Next after Cancel returned an event")
+	}
+	if !settle(func() bool { return c.Stats().Watches == 0 }) {
+		t.Fatalf("Watches after Cancel: %d, want 0", c.Stats().Watches)
+	}
+}
@@ -0,0 +1,25 @@
+package doozer
+
+import (
+	"code.google.com/p/goprotobuf/proto"
+)
+
+// marshal and unmarshal convert between messages and the bytes of
+// a frame. They, with the generated code in msg.pb.go, are all that
+// depends on the protobuf runtime; to swap the runtime, change them
+// and regenerate msg.pb.go.
+
+// A message is a *request or a *response.
+type message interface {
+	Reset()
+	String() string
+	ProtoMessage()
+}
+
+func marshal(m message) ([]byte, error) {
+	return proto.Marshal(m)
+}
+
+func unmarshal(buf []byte, m message) error {
+	return proto.Unmarshal(buf, m)
+}
@@ -0,0 +1,88 @@
+package doozer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/ha/doozer/doozertest"
+)
+
+// TestWireGolden checks marshal and unmarshal, for both kinds of
+// message, against the messages in testdata/frames.txt, so another
+// protobuf runtime behind them can be checked byte for byte.
+func TestWireGolden(t *testing.T) {
+	for _, v := range readVectors(t) {
+		var want, got message
+		switch v.kind {
+		case "request":
+			want, got = new(request), new(request)
+		case "response":
+			want, got = new(response), new(response)
+		default:
+			t.Fatalf("%s:%d: unknown kind %q", framesFile, v.line, v.kind)
+		}
+		v.build(t, want)
+
+		buf, err := marshal(want)
+		if err != nil {
+			t.Fatalf("%s:%d: marshal: %v", framesFile, v.line, err)
+		}
+		if !bytes.Equal(buf, v.frame[4:]) {
+			t.Errorf("%s:%d: marshal %s\n got %x\nwant %x", framesFile, v.line, want, buf, v.frame[4:])
+		}
+		if err := unmarshal(v.frame[4:], got); err != nil {
+			t.Fatalf("%s:%d: unmarshal: %v", framesFile, v.line, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s:%d: unmarshal\n got %s\nwant %s", framesFile, v.line, got, want)
+		}
+	}
+}
+
+// TestWireSession decodes and re-encodes every frame of the recorded
+// session in testdata/session.rec, which must come out unchanged.
+func TestWireSession(t *testing.T) {
+	f, err := os.Open(sessionFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var n int
+	for {
+		// direction, time, length
+		var hdr [1 + 8 + 4]byte
+		if _, err := io.ReadFull(f, hdr[:]); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		frame := make([]byte, binary.BigEndian.Uint32(hdr[9:]))
+		if _, err := io.ReadFull(f, frame); err != nil {
+			t.Fatal(err)
+		}
+
+		var m message = new(request)
+		if hdr[0] == doozertest.ToClient {
+			m = new(response)
+		}
+		if err := unmarshal(frame, m); err != nil {
+			t.Fatalf("frame %d: %v", n, err)
+		}
+		buf, err := marshal(m)
+		if err != nil {
+			t.Fatalf("frame %d: %v", n, err)
+		}
+		if !bytes.Equal(buf, frame) {
+			t.Errorf("frame %d: %s\n got %x\nwant %x", n, m, buf, frame)
+		}
+		n++
+	}
+	if n == 0 {
+		t.Fatalf("%s: no frames", sessionFile)
+	}
+}